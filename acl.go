@@ -0,0 +1,44 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"net"
+
+	"github.com/coredns/coredns/request"
+)
+
+// ACLRule allows or denies queries of clients within its networks
+type ACLRule struct {
+	Allow    bool
+	Networks []*net.IPNet
+}
+
+// allowed reports whether the client of state may query. The first rule with
+// a network containing the client decides, clients matching no rule are
+// allowed.
+func (n *Netbox) allowed(state request.Request) bool {
+	if len(n.ACL) == 0 {
+		return true
+	}
+	ip := net.ParseIP(state.IP())
+	for _, rule := range n.ACL {
+		for _, network := range rule.Networks {
+			if network.Contains(ip) {
+				return rule.Allow
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestACLServeDNS(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	_, office, _ := net.ParseCIDR("10.1.0.0/16")
+	_, internal, _ := net.ParseCIDR("10.0.0.0/8")
+
+	tests := []struct {
+		name     string
+		remoteIP string
+		rcode    int
+	}{
+		{"Client allowed by first rule", "10.1.2.3", dns.RcodeSuccess},
+		{"Client denied by second rule", "10.2.3.4", dns.RcodeRefused},
+		{"Client matching no rule", "192.0.2.1", dns.RcodeSuccess},
+	}
+
+	for _, tt := range tests {
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 8600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.org."}]}`)
+
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+		n.Zones = []string{"example.org."}
+		n.UsePlugin = true
+		n.ACL = []ACLRule{
+			{Allow: true, Networks: []*net.IPNet{office}},
+			{Allow: false, Networks: []*net.IPNet{internal}},
+		}
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: tt.remoteIP})
+		r := new(dns.Msg)
+		r.SetQuestion("mail1.example.org.", dns.TypeA)
+		_, err := n.ServeDNS(context.Background(), rec, r)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.rcode, rec.Rcode, tt.name)
+		if tt.rcode == dns.RcodeRefused {
+			// NetBox is not asked for denied clients
+			assert.Empty(t, rec.Msg.Answer, tt.name)
+			assert.False(t, gock.IsDone(), tt.name)
+		} else {
+			assert.Len(t, rec.Msg.Answer, 1, tt.name)
+			assert.True(t, gock.IsDone(), tt.name)
+		}
+		gock.Off()
+	}
+}
+
+func TestACLWithoutRules(t *testing.T) {
+	n := newNetbox()
+	state := request.Request{W: &test.ResponseWriter{RemoteIP: "192.0.2.1"}, Req: new(dns.Msg)}
+
+	// without rules all clients are allowed
+	assert.True(t, n.allowed(state))
+}
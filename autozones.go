@@ -0,0 +1,68 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"context"
+	"slices"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+)
+
+// refreshZones merges the active zones of netbox-dns with the configured
+// zones, the zones found before are kept if NetBox can not be queried
+func (n *Netbox) refreshZones(ctx context.Context) error {
+	zones, err := n.queryActiveZones(ctx)
+	if err != nil {
+		return err
+	}
+
+	served := slices.Clone(n.Zones)
+	for _, zone := range zones {
+		name := dns.CanonicalName(zone.Name)
+		if !slices.Contains(served, name) {
+			served = append(served, name)
+		}
+	}
+
+	n.mu.Lock()
+	changed := !slices.Equal(n.served, served)
+	n.served = served
+	n.mu.Unlock()
+	if changed {
+		log.Infof("Responsible zones: %v", served)
+	}
+	return nil
+}
+
+// servedZones returns the zones the plugin is authoritative for
+func (n *Netbox) servedZones() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.served == nil {
+		return n.Zones
+	}
+	return n.served
+}
+
+// zoneOf returns the most specific served zone name is within, records are
+// looked up in it. zone is returned if none is more specific than zone.
+func (n *Netbox) zoneOf(zone, name string) string {
+	z := plugin.Zones(n.servedZones()).Matches(name)
+	if z == "" || (dns.IsSubDomain(zone, name) && !dns.IsSubDomain(zone, z)) {
+		return zone
+	}
+	return z
+}
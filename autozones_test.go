@@ -0,0 +1,46 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestRefreshZones(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	// a zone may exist in several views but is served once
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParam("active", "^true$").
+		Reply(200).BodyString(`{"results": [{"name": "example.com"}, {"name": "example.org"}, {"name": "Example.com"}]}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").Reply(500)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org.", "example.net."}
+
+	want := []string{"example.org.", "example.net.", "example.com."}
+	assert.NoError(t, n.refreshZones(context.Background()))
+	assert.Equal(t, want, n.servedZones())
+
+	// the zones found before are kept if NetBox fails
+	assert.Error(t, n.refreshZones(context.Background()))
+	assert.Equal(t, want, n.servedZones())
+	assert.Equal(t, []string{"example.org.", "example.net."}, n.Zones)
+	assert.True(t, gock.IsDone())
+}
@@ -0,0 +1,261 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultCacheSize  = 10000
+	defaultCachePurge = time.Minute
+
+	// staleTTL is the TTL of answers served from expired entries
+	staleTTL = 30
+)
+
+// timeNow is the clock used for cache expiry, tests may replace it
+var timeNow = time.Now
+
+// cacheKey identifies a cached response
+type cacheKey struct {
+	zone  string
+	view  string
+	name  string
+	qtype uint16
+}
+
+// cacheEntry holds the answers and additional records of a response until it
+// expires
+type cacheEntry struct {
+	key     cacheKey
+	answers []dns.RR
+	extra   []dns.RR
+	stored  time.Time
+	expires time.Time
+}
+
+// cache is an in-memory response cache. A nil *cache is valid and behaves
+// like a cache that never holds any entry. Once full the least recently used
+// entry is evicted.
+type cache struct {
+	sync.Mutex
+	entries map[cacheKey]*list.Element
+	// lru holds the entries, the most recently used one in front
+	lru        *list.List
+	maxEntries int
+	// stale is how long expired entries are kept to be served when NetBox
+	// can not be queried
+	stale time.Duration
+	stop  chan struct{}
+}
+
+// newCache returns a cache holding at most maxEntries responses
+func newCache(maxEntries int) *cache {
+	return &cache{
+		entries:    make(map[cacheKey]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+// get returns a copy of the cached answers and additional records for key if
+// present and not expired. Their TTL is lowered by the time they have been
+// cached.
+func (c *cache) get(key cacheKey) ([]dns.RR, []dns.RR, bool) {
+	if c == nil {
+		return nil, nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !timeNow().Before(entry.expires) {
+		return nil, nil, false
+	}
+	c.lru.MoveToFront(elem)
+	elapsed := uint32(timeNow().Sub(entry.stored) / time.Second)
+	return copyRRs(entry.answers, elapsed, math.MaxUint32), copyRRs(entry.extra, elapsed, math.MaxUint32), true
+}
+
+// getStale returns a copy of the answers and additional records for key if
+// the entry expired no longer than the stale window ago. Their TTL is lowered
+// to staleTTL.
+func (c *cache) getStale(key cacheKey) ([]dns.RR, []dns.RR, bool) {
+	if c == nil || c.stale <= 0 {
+		return nil, nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !timeNow().Before(entry.expires.Add(c.stale)) {
+		return nil, nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return copyRRs(entry.answers, 0, staleTTL), copyRRs(entry.extra, 0, staleTTL), true
+}
+
+// copyRRs returns a deep copy of rrs with their TTL lowered by elapsed seconds
+// and capped at maxTTL
+func copyRRs(rrs []dns.RR, elapsed, maxTTL uint32) []dns.RR {
+	if rrs == nil {
+		return nil
+	}
+	copied := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		copied[i] = dns.Copy(rr)
+		copied[i].Header().Ttl = min(rr.Header().Ttl-min(rr.Header().Ttl, elapsed), maxTTL)
+	}
+	return copied
+}
+
+// set stores answers and additional records for key, expiring after the lowest
+// TTL of all of them. It reports whether another entry was evicted.
+func (c *cache) set(key cacheKey, answers, extra []dns.RR) bool {
+	if c == nil || len(answers) == 0 {
+		return false
+	}
+	ttl := answers[0].Header().Ttl
+	for _, rrs := range [][]dns.RR{answers, extra} {
+		for _, rr := range rrs {
+			ttl = min(ttl, rr.Header().Ttl)
+		}
+	}
+	return c.store(key, answers, extra, time.Duration(ttl)*time.Second)
+}
+
+// setNegative remembers for ttl that key has no answers. It reports whether
+// another entry was evicted.
+func (c *cache) setNegative(key cacheKey, ttl time.Duration) bool {
+	if c == nil {
+		return false
+	}
+	return c.store(key, nil, nil, ttl)
+}
+
+func (c *cache) store(key cacheKey, answers, extra []dns.RR, ttl time.Duration) bool {
+	// a TTL of zero means the answer must not be cached
+	if ttl <= 0 {
+		return false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := timeNow()
+	entry := &cacheEntry{
+		key:     key,
+		answers: answers,
+		extra:   extra,
+		stored:  now,
+		expires: now.Add(ttl),
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return false
+	}
+
+	evicted := false
+	if len(c.entries) >= c.maxEntries {
+		c.removeLocked(c.lru.Back())
+		evicted = true
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	return evicted
+}
+
+// removeLocked removes the entry held by elem
+func (c *cache) removeLocked(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// countEviction increments the eviction metric of the server handling ctx if
+// an entry was evicted
+func countEviction(ctx context.Context, evicted bool) {
+	if evicted {
+		cacheEvictions.WithLabelValues(metrics.WithServer(ctx)).Inc()
+	}
+}
+
+// len returns the number of entries, including expired ones not purged yet
+func (c *cache) len() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.entries)
+}
+
+// purge removes all entries expired longer than the stale window ago
+func (c *cache) purge() {
+	c.Lock()
+	defer c.Unlock()
+	c.purgeLocked()
+}
+
+func (c *cache) purgeLocked() {
+	now := timeNow()
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if !now.Before(elem.Value.(*cacheEntry).expires.Add(c.stale)) {
+			c.removeLocked(elem)
+		}
+		elem = next
+	}
+}
+
+// start removes expired entries every interval until stop is called
+func (c *cache) start(interval time.Duration) {
+	if c == nil {
+		return
+	}
+	c.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.purge()
+			case <-stop:
+				return
+			}
+		}
+	}(c.stop)
+}
+
+// shutdown stops the background purge started by start
+func (c *cache) shutdown() {
+	if c == nil || c.stop == nil {
+		return
+	}
+	close(c.stop)
+	c.stop = nil
+}
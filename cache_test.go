@@ -0,0 +1,378 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestCacheServeDNS(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	// only a single upstream response is mocked, a second request would fail
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.org",
+			"active": "true",
+			"fqdn":   "mail1.example.org.",
+			"type":   "A",
+		}).Reply(200).BodyString(`{
+			"results": [
+			{
+				"type": "A",
+				"ttl": 8600,
+				"value": "192.168.0.1",
+				"absolute_value": "192.168.0.1",
+				"fqdn": "mail1.example.org."
+			}]
+		}`)
+
+	nb := newNetbox()
+	nb.Url = "https://example.org"
+	nb.Token = "s3kr3tt0ken"
+	nb.Zones = []string{"example.org."}
+	nb.UsePlugin = true
+	nb.cache = newCache(defaultCacheSize)
+
+	labels := map[string]string{"server": ""}
+	hits := metricValue(t, cacheHits, labels)
+	misses := metricValue(t, cacheMisses, labels)
+
+	for i := 0; i < 2; i++ {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion("mail1.example.org.", dns.TypeA)
+
+		rcode, err := nb.ServeDNS(context.Background(), rec, r)
+		assert.NoError(t, err)
+		assert.Equal(t, dns.RcodeSuccess, rcode)
+		if assert.Len(t, rec.Msg.Answer, 1) {
+			assert.Equal(t, "mail1.example.org.\t8600\tIN\tA\t192.168.0.1", rec.Msg.Answer[0].String())
+		}
+
+		// the first query misses the cache, the second one hits it
+		assert.Equal(t, misses+1, metricValue(t, cacheMisses, labels))
+		assert.Equal(t, hits+float64(i), metricValue(t, cacheHits, labels))
+		assert.Equal(t, float64(1), metricValue(t, cacheEntries, labels))
+	}
+
+	assert.True(t, gock.IsDone())
+}
+
+func TestNegativeCacheServeDNS(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	// the missing A record and the zone SOA are only mocked once, the records
+	// of the name are checked for its existence before falling back to a
+	// wildcard and for the NODATA answer
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.org",
+			"active": "true",
+			"fqdn":   "mail1.example.org.",
+		}).AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+		return len(req.URL.Query()["type"]) > 2, nil
+	}).Times(2).Reply(200).BodyString(`{
+			"results": [
+			{
+				"type": "AAAA",
+				"ttl": 8600,
+				"value": "2001:db8::1",
+				"absolute_value": "2001:db8::1",
+				"fqdn": "mail1.example.org."
+			}]
+		}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.org",
+			"active": "true",
+			"fqdn":   "mail1.example.org.",
+			"type":   "A",
+		}).Reply(200).BodyString(`{"results": []}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
+		map[string]string{
+			"name":   "example.org",
+			"active": "true",
+		}).Reply(200).BodyString(`{
+			"results": [
+			{
+				"name": "example.org",
+				"soa_ttl": 86400,
+				"soa_mname": {
+					"name": "ns1.example.org"
+				},
+				"soa_rname": "admin.example.org",
+				"soa_serial": 1742857987,
+				"soa_refresh": 43200,
+				"soa_retry": 7200,
+				"soa_expire": 2419200,
+				"soa_minimum": 3600
+			}]
+		}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.org",
+			"active": "true",
+			"fqdn":   "mail1.example.org.",
+			"type":   "AAAA",
+		}).Reply(200).BodyString(`{
+			"results": [
+			{
+				"type": "AAAA",
+				"ttl": 8600,
+				"value": "2001:db8::1",
+				"absolute_value": "2001:db8::1",
+				"fqdn": "mail1.example.org."
+			}]
+		}`)
+
+	nb := newNetbox()
+	nb.Url = "https://example.org"
+	nb.Token = "s3kr3tt0ken"
+	nb.Zones = []string{"example.org."}
+	nb.UsePlugin = true
+	nb.cache = newCache(defaultCacheSize)
+
+	for i := 0; i < 2; i++ {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion("mail1.example.org.", dns.TypeA)
+
+		// the name exists with an AAAA record, so the A record is NODATA
+		_, err := nb.ServeDNS(context.Background(), rec, r)
+		assert.NoError(t, err)
+		assert.Equal(t, dns.RcodeSuccess, rec.Msg.Rcode)
+		assert.Empty(t, rec.Msg.Answer)
+		assert.Len(t, rec.Msg.Ns, 1)
+	}
+
+	// the missing A record must not suppress the present AAAA record
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("mail1.example.org.", dns.TypeAAAA)
+
+	_, err := nb.ServeDNS(context.Background(), rec, r)
+	assert.NoError(t, err)
+	assert.Len(t, rec.Msg.Answer, 1)
+
+	assert.True(t, gock.IsDone())
+}
+
+func TestCacheExpiry(t *testing.T) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	c := newCache(1)
+	key := cacheKey{zone: "example.org.", name: "mail1.example.org.", qtype: dns.TypeA}
+	rr, _ := dns.NewRR("mail1.example.org. 60 IN A 192.168.0.1")
+	c.set(key, []dns.RR{rr}, nil)
+
+	answers, _, ok := c.get(key)
+	assert.True(t, ok)
+	assert.Equal(t, []dns.RR{rr}, answers)
+
+	now = now.Add(time.Minute)
+	_, _, ok = c.get(key)
+	assert.False(t, ok)
+
+	c.purge()
+	assert.Empty(t, c.entries)
+
+	c.setNegative(key, time.Minute)
+	answers, _, ok = c.get(key)
+	assert.True(t, ok)
+	assert.Empty(t, answers)
+}
+
+func TestCacheTTLDecrement(t *testing.T) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	c := newCache(defaultCacheSize)
+	key := cacheKey{zone: "example.org.", name: "example.org.", qtype: dns.TypeMX}
+	mx, _ := dns.NewRR("example.org. 300 IN MX 10 mail1.example.org.")
+	a, _ := dns.NewRR("mail1.example.org. 60 IN A 192.168.0.1")
+	c.set(key, []dns.RR{mx}, []dns.RR{a})
+
+	// the remaining lifetime is served
+	now = now.Add(time.Second*20 + time.Millisecond*500)
+	answers, extra, ok := c.get(key)
+	if assert.True(t, ok) && assert.Len(t, answers, 1) && assert.Len(t, extra, 1) {
+		assert.Equal(t, uint32(280), answers[0].Header().Ttl)
+		assert.Equal(t, uint32(40), extra[0].Header().Ttl)
+	}
+
+	// the cached records are left untouched
+	assert.Equal(t, uint32(300), mx.Header().Ttl)
+
+	// the entry is dropped once the lowest TTL is used up
+	now = now.Add(time.Second * 40)
+	_, _, ok = c.get(key)
+	assert.False(t, ok)
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := newCache(2)
+	keys := []cacheKey{
+		{zone: "example.org.", name: "mail1.example.org.", qtype: dns.TypeA},
+		{zone: "example.org.", name: "mail2.example.org.", qtype: dns.TypeA},
+		{zone: "example.org.", name: "mail3.example.org.", qtype: dns.TypeA},
+	}
+	rr, _ := dns.NewRR("mail1.example.org. 60 IN A 192.168.0.1")
+
+	assert.False(t, c.set(keys[0], []dns.RR{rr}, nil))
+	assert.False(t, c.set(keys[1], []dns.RR{rr}, nil))
+
+	// using the oldest entry makes the second one the least recently used
+	_, _, ok := c.get(keys[0])
+	assert.True(t, ok)
+
+	assert.True(t, c.set(keys[2], []dns.RR{rr}, nil))
+	assert.Equal(t, 2, c.len())
+	_, _, ok = c.get(keys[1])
+	assert.False(t, ok)
+	for _, key := range []cacheKey{keys[0], keys[2]} {
+		_, _, ok = c.get(key)
+		assert.True(t, ok)
+	}
+
+	// replacing an entry evicts none
+	assert.False(t, c.set(keys[0], []dns.RR{rr}, nil))
+	assert.Equal(t, 2, c.len())
+}
+
+func TestCacheEvictionServeDNS(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	for _, name := range []string{"mail1.example.org.", "mail2.example.org."} {
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+			map[string]string{
+				"zone": "^example.org$",
+				"fqdn": "^" + name + "$",
+				"type": "^A$",
+			}).Reply(200).BodyString(`{
+			"results": [
+			{
+				"type": "A",
+				"ttl": 8600,
+				"value": "192.168.0.1",
+				"absolute_value": "192.168.0.1",
+				"fqdn": "` + name + `"
+			}]
+		}`)
+	}
+
+	nb := newNetbox()
+	nb.Url = "https://example.org"
+	nb.Token = "s3kr3tt0ken"
+	nb.Zones = []string{"example.org."}
+	nb.UsePlugin = true
+	nb.cache = newCache(1)
+
+	labels := map[string]string{"server": ""}
+	evictions := metricValue(t, cacheEvictions, labels)
+
+	for _, name := range []string{"mail1.example.org.", "mail2.example.org."} {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		_, err := nb.ServeDNS(context.Background(), rec, r)
+		assert.NoError(t, err)
+		assert.Len(t, rec.Msg.Answer, 1)
+	}
+
+	// the answer for mail1 made room for mail2
+	assert.Equal(t, evictions+1, metricValue(t, cacheEvictions, labels))
+	_, _, ok := nb.cache.get(cacheKey{zone: "example.org.", name: "mail1.example.org.", qtype: dns.TypeA})
+	assert.False(t, ok)
+	_, _, ok = nb.cache.get(cacheKey{zone: "example.org.", name: "mail2.example.org.", qtype: dns.TypeA})
+	assert.True(t, ok)
+	assert.True(t, gock.IsDone())
+}
+
+func TestCacheServeStale(t *testing.T) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^mail1.example.org.$",
+			"type": "^A$",
+		}).Reply(200).BodyString(`{
+			"results": [
+			{
+				"type": "A",
+				"ttl": 60,
+				"value": "192.168.0.1",
+				"absolute_value": "192.168.0.1",
+				"fqdn": "mail1.example.org."
+			}]
+		}`)
+
+	nb := newNetbox()
+	nb.Url = "https://example.org"
+	nb.Token = "s3kr3tt0ken"
+	nb.Zones = []string{"example.org."}
+	nb.UsePlugin = true
+	nb.cache = newCache(defaultCacheSize)
+	nb.cache.stale = time.Hour
+
+	labels := map[string]string{"server": ""}
+	stale := metricValue(t, cacheStale, labels)
+
+	serve := func() *dnstest.Recorder {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion("mail1.example.org.", dns.TypeA)
+		_, _ = nb.ServeDNS(context.Background(), rec, r)
+		return rec
+	}
+
+	// fill the cache while NetBox is reachable
+	rec := serve()
+	assert.Equal(t, dns.RcodeSuccess, rec.Rcode)
+	assert.Len(t, rec.Msg.Answer, 1)
+
+	// NetBox fails once the entry expired, the stale answer is served
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").Persist().Reply(500)
+	now = now.Add(time.Minute * 5)
+	nb.cache.purge()
+	rec = serve()
+	assert.Equal(t, dns.RcodeSuccess, rec.Rcode)
+	if assert.Len(t, rec.Msg.Answer, 1) {
+		assert.Equal(t, "mail1.example.org.\t30\tIN\tA\t192.168.0.1", rec.Msg.Answer[0].String())
+	}
+	assert.Equal(t, stale+1, metricValue(t, cacheStale, labels))
+
+	// beyond the stale window the failure is returned
+	now = now.Add(time.Hour)
+	rec = serve()
+	assert.Equal(t, dns.RcodeServerFailure, rec.Rcode)
+	assert.Equal(t, stale+1, metricValue(t, cacheStale, labels))
+}
@@ -0,0 +1,177 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// signatures are valid from an hour in the past, to allow for clock skew, for
+// a week
+const (
+	signatureInception = time.Hour
+	signatureValidity  = 7 * 24 * time.Hour
+)
+
+// signingKey is a DNSSEC key the answers of the zone owning it are signed with
+type signingKey struct {
+	key    *dns.DNSKEY
+	signer crypto.Signer
+}
+
+// parseKeyFile reads the key pair generated by dnssec-keygen, base is the path
+// without the .key and .private extensions
+func parseKeyFile(base string) (*signingKey, error) {
+	pub, err := os.Open(filepath.Clean(base + ".key"))
+	if err != nil {
+		return nil, err
+	}
+	defer pub.Close()
+	rr, err := dns.ReadRR(pub, base+".key")
+	if err != nil {
+		return nil, err
+	}
+	key, ok := rr.(*dns.DNSKEY)
+	if !ok {
+		return nil, fmt.Errorf("no public key found in %s.key", base)
+	}
+
+	priv, err := os.Open(filepath.Clean(base + ".private"))
+	if err != nil {
+		return nil, err
+	}
+	defer priv.Close()
+	private, err := key.ReadPrivateKey(priv, base+".private")
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("no private key found in %s.private", base)
+	}
+	key.Hdr.Name = dns.CanonicalName(key.Hdr.Name)
+	return &signingKey{key: key, signer: signer}, nil
+}
+
+// signingKeys returns the keys zone is signed with
+func (n *Netbox) signingKeys(zone string) []*signingKey {
+	var keys []*signingKey
+	for _, k := range n.keys {
+		if k.key.Hdr.Name == zone {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// dnskeys returns the DNSKEY records of keys with the given TTL
+func dnskeys(keys []*signingKey, ttl uint32) []dns.RR {
+	rrs := make([]dns.RR, len(keys))
+	for i, k := range keys {
+		key := dns.Copy(k.key).(*dns.DNSKEY)
+		key.Hdr.Ttl = ttl
+		rrs[i] = key
+	}
+	return rrs
+}
+
+// sign returns copies of rrs followed by the RRSIG records of each of their
+// RRsets made with every key. RRsets failing to sign are returned unsigned.
+func sign(keys []*signingKey, rrs []dns.RR, now time.Time) []dns.RR {
+	type rrset struct {
+		name  string
+		qtype uint16
+	}
+	var (
+		order  []rrset
+		sets   = make(map[rrset][]dns.RR)
+		signed = make([]dns.RR, len(rrs))
+	)
+	// rrs may be shared with the cache, their TTLs are aligned below
+	for i, rr := range rrs {
+		signed[i] = dns.Copy(rr)
+	}
+	for _, rr := range signed {
+		if rr.Header().Rrtype == dns.TypeRRSIG {
+			continue
+		}
+		set := rrset{dns.CanonicalName(rr.Header().Name), rr.Header().Rrtype}
+		if _, ok := sets[set]; !ok {
+			order = append(order, set)
+		}
+		sets[set] = append(sets[set], rr)
+	}
+
+	for _, set := range order {
+		records := sets[set]
+		// all records of an RRset must share a TTL, the lowest one is used
+		ttl := records[0].Header().Ttl
+		for _, rr := range records {
+			ttl = min(ttl, rr.Header().Ttl)
+		}
+		for _, rr := range records {
+			rr.Header().Ttl = ttl
+		}
+
+		for _, k := range keys {
+			sig := &dns.RRSIG{
+				Hdr:        dns.RR_Header{Ttl: ttl},
+				Algorithm:  k.key.Algorithm,
+				KeyTag:     k.key.KeyTag(),
+				SignerName: k.key.Hdr.Name,
+				Inception:  uint32(now.Add(-signatureInception).Unix()),
+				Expiration: uint32(now.Add(signatureValidity).Unix()),
+			}
+			if err := sig.Sign(k.signer, records); err != nil {
+				log.Errorf("could not sign %s %s: %s", set.name, dns.TypeToString[set.qtype], err)
+				continue
+			}
+			signed = append(signed, sig)
+		}
+	}
+	return signed
+}
+
+// denial returns the NSEC record proving that qname has no records of other
+// types than types. Names which do not exist are claimed to exist without any
+// records, this way denials are answered on the fly without knowing the
+// neighbours of qname.
+func denial(qname string, types []uint16, ttl uint32) dns.RR {
+	bitmap := []uint16{dns.TypeRRSIG, dns.TypeNSEC}
+	apex := slices.Contains(types, dns.TypeSOA)
+	for _, t := range types {
+		// resolvers reject proofs of names with a CNAME, DS records belong
+		// to the parent and NS records outside of the apex make the name a
+		// delegation
+		if t == dns.TypeCNAME || t == dns.TypeDS || (t == dns.TypeNS && !apex) {
+			continue
+		}
+		if !slices.Contains(bitmap, t) {
+			bitmap = append(bitmap, t)
+		}
+	}
+	slices.Sort(bitmap)
+	return &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: qname, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: ttl},
+		NextDomain: "\\000." + qname,
+		TypeBitMap: bitmap,
+	}
+}
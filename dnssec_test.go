@@ -0,0 +1,242 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// writeKey generates a key for zone like dnssec-keygen does and returns the
+// path of its files without extension
+func writeKey(t *testing.T, zone string) string {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	private, err := key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := filepath.Join(t.TempDir(), fmt.Sprintf("K%s+%03d+%05d", zone, key.Algorithm, key.KeyTag()))
+	if err := os.WriteFile(base+".key", []byte(key.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(base+".private", []byte(key.PrivateKeyString(private)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return base
+}
+
+// signedNetbox returns a netbox signing example.org. with a generated key
+func signedNetbox(t *testing.T) *Netbox {
+	key, err := parseKeyFile(writeKey(t, "example.org."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+	n.DNSSEC = true
+	n.keys = []*signingKey{key}
+	return n
+}
+
+// verify asserts that every RRset of rrs is signed by the key of n
+func verify(t *testing.T, n *Netbox, rrs []dns.RR) {
+	var sigs []*dns.RRSIG
+	sets := make(map[uint16][]dns.RR)
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			sigs = append(sigs, sig)
+		} else {
+			sets[rr.Header().Rrtype] = append(sets[rr.Header().Rrtype], rr)
+		}
+	}
+	if !assert.Len(t, sigs, len(sets)) {
+		return
+	}
+	for _, sig := range sigs {
+		assert.NoError(t, sig.Verify(n.keys[0].key, sets[sig.TypeCovered]), dns.TypeToString[sig.TypeCovered])
+		assert.True(t, sig.ValidityPeriod(timeNow()))
+	}
+}
+
+func TestParseKeyFile(t *testing.T) {
+	base := writeKey(t, "example.org.")
+
+	key, err := parseKeyFile(base)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "example.org.", key.key.Hdr.Name)
+		assert.Equal(t, dns.ECDSAP256SHA256, key.key.Algorithm)
+		assert.NotNil(t, key.signer)
+	}
+
+	_, err = parseKeyFile(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestServeDNSSigned(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"fqdn": "^mail1.example.org.$",
+		}).Reply(200).BodyString(`{"results": [
+			{"type": "A", "ttl": 3600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.org."},
+			{"type": "A", "ttl": 600, "value": "192.168.0.2", "absolute_value": "192.168.0.2", "fqdn": "mail1.example.org."}
+		]}`)
+
+	n := signedNetbox(t)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("mail1.example.org.", dns.TypeA)
+	r.SetEdns0(4096, true)
+	_, err := n.ServeDNS(context.Background(), rec, r)
+	assert.NoError(t, err)
+	if assert.Len(t, rec.Msg.Answer, 3) {
+		// the RRset shares the lowest TTL
+		assert.Equal(t, uint32(600), rec.Msg.Answer[0].Header().Ttl)
+		verify(t, n, rec.Msg.Answer)
+	}
+	assert.True(t, rec.Msg.IsEdns0().Do())
+}
+
+func TestServeDNSSignedDenial(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").Persist().Reply(200).BodyString(`{"results": []}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").Persist().Reply(200).BodyString(`{"results": [{"name": "example.org", "soa_mname": {"name": "ns1.example.org"}, "soa_rname": "hostmaster.example.org", "soa_minimum": 300, "soa_ttl": 3600}]}`)
+
+	n := signedNetbox(t)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("missing.example.org.", dns.TypeA)
+	r.SetEdns0(4096, true)
+	_, err := n.ServeDNS(context.Background(), rec, r)
+	assert.NoError(t, err)
+
+	// the missing name is answered as NODATA proven by an NSEC record
+	assert.Equal(t, dns.RcodeSuccess, rec.Msg.Rcode)
+	assert.Empty(t, rec.Msg.Answer)
+	if assert.Len(t, rec.Msg.Ns, 4) {
+		nsec, ok := rec.Msg.Ns[1].(*dns.NSEC)
+		if assert.True(t, ok) {
+			assert.Equal(t, "missing.example.org.", nsec.Hdr.Name)
+			assert.Equal(t, "\\000.missing.example.org.", nsec.NextDomain)
+			assert.Equal(t, []uint16{dns.TypeRRSIG, dns.TypeNSEC}, nsec.TypeBitMap)
+			assert.Equal(t, uint32(300), nsec.Hdr.Ttl)
+		}
+		verify(t, n, rec.Msg.Ns)
+	}
+
+	// without the DO bit the denial is not signed
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	r = new(dns.Msg)
+	r.SetQuestion("missing.example.org.", dns.TypeA)
+	_, err = n.ServeDNS(context.Background(), rec, r)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeNameError, rec.Msg.Rcode)
+	assert.Len(t, rec.Msg.Ns, 1)
+}
+
+func TestServeDNSKEY(t *testing.T) {
+	n := signedNetbox(t)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("example.org.", dns.TypeDNSKEY)
+	r.SetEdns0(4096, true)
+	_, err := n.ServeDNS(context.Background(), rec, r)
+	assert.NoError(t, err)
+	if assert.Len(t, rec.Msg.Answer, 2) {
+		assert.Equal(t, n.keys[0].key.PublicKey, rec.Msg.Answer[0].(*dns.DNSKEY).PublicKey)
+		verify(t, n, rec.Msg.Answer)
+	}
+}
+
+func TestServeDNSSignedNODATA(t *testing.T) {
+	tests := []struct {
+		name    string
+		qname   string
+		records string
+		want    []uint16
+	}{
+		{
+			"name below the apex",
+			"www.example.org.",
+			`{"type": "A", "ttl": 3600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "www.example.org."},
+			{"type": "MX", "ttl": 3600, "value": "10 mail1.example.org.", "absolute_value": "10 mail1.example.org.", "fqdn": "www.example.org."},
+			{"type": "NS", "ttl": 3600, "value": "ns1.example.net.", "absolute_value": "ns1.example.net.", "fqdn": "www.example.org."}`,
+			[]uint16{dns.TypeA, dns.TypeMX, dns.TypeRRSIG, dns.TypeNSEC},
+		},
+		{
+			"apex",
+			"example.org.",
+			`{"type": "MX", "ttl": 3600, "value": "10 mail1.example.org.", "absolute_value": "10 mail1.example.org.", "fqdn": "example.org."}`,
+			[]uint16{dns.TypeNS, dns.TypeSOA, dns.TypeMX, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeDNSKEY},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer gock.Off() // Flush pending mocks after test execution
+
+			gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+				map[string]string{
+					"fqdn": "^" + tt.qname + "$",
+					"type": "^A$",
+				}).Persist().Reply(200).BodyString(`{"results": [` + tt.records + `]}`)
+			gock.New("https://example.org/api/plugins/netbox-dns/records/").Persist().Reply(200).BodyString(`{"results": []}`)
+			gock.New("https://example.org/api/plugins/netbox-dns/zones/").Persist().Reply(200).BodyString(`{"results": [{"name": "example.org", "soa_mname": {"name": "ns1.example.org"}, "soa_rname": "hostmaster.example.org", "soa_minimum": 300, "soa_ttl": 3600}]}`)
+
+			n := signedNetbox(t)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			r := new(dns.Msg)
+			r.SetQuestion(tt.qname, dns.TypeAAAA)
+			r.SetEdns0(4096, true)
+			_, err := n.ServeDNS(context.Background(), rec, r)
+			assert.NoError(t, err)
+
+			// the NSEC record holds the types existing at the name only
+			assert.Equal(t, dns.RcodeSuccess, rec.Msg.Rcode)
+			assert.Empty(t, rec.Msg.Answer)
+			if assert.Len(t, rec.Msg.Ns, 4) {
+				nsec, ok := rec.Msg.Ns[1].(*dns.NSEC)
+				if assert.True(t, ok) {
+					assert.Equal(t, tt.want, nsec.TypeBitMap)
+				}
+				verify(t, n, rec.Msg.Ns)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/coredns/coredns/plugin/dnstap"
+	"github.com/coredns/coredns/plugin/dnstap/msg"
+	"github.com/coredns/coredns/request"
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+)
+
+// tapper receives dnstap messages, it is implemented by the dnstap plugin
+type tapper interface {
+	TapMessageWithMetadata(ctx context.Context, m *tap.Message, state request.Request)
+}
+
+// tapTarget is a tapper along with whether it wants the packed DNS messages
+type tapTarget struct {
+	tapper
+	includeRaw bool
+}
+
+// setTapPlugin adds the dnstap plugin and all dnstap plugins chained after
+// it to the tappers lookups are sent to
+func (n *Netbox) setTapPlugin(tapPlugin *dnstap.Dnstap) {
+	n.taps = append(n.taps, tapTarget{tapper: tapPlugin, includeRaw: tapPlugin.IncludeRawMessage})
+	if next, ok := tapPlugin.Next.(*dnstap.Dnstap); ok {
+		n.setTapPlugin(next)
+	}
+}
+
+// tapLookup sends the lookup of the question of state in NetBox started at
+// start to the tappers as forwarder query and, unless it failed with err, as
+// forwarder response carrying answers. The messages written to the client are
+// tapped by the dnstap plugin itself. Lookups without a client, like those of
+// LookupRecords, are tapped without query address.
+func (n *Netbox) tapLookup(ctx context.Context, state request.Request, answers []dns.RR, err error, start time.Time) {
+	var reply *dns.Msg
+	if err == nil {
+		reply = new(dns.Msg)
+		reply.SetReply(state.Req)
+		reply.Authoritative = true
+		reply.Answer = answers
+	}
+
+	var client net.Addr
+	if state.W != nil {
+		client = state.W.RemoteAddr()
+	}
+	upstream := n.upstreamAddr()
+	for _, t := range n.taps {
+		q := new(tap.Message)
+		msg.SetQueryTime(q, start)
+		if client != nil {
+			_ = msg.SetQueryAddress(q, client)
+		}
+		if upstream != nil {
+			_ = msg.SetResponseAddress(q, upstream)
+		}
+		if t.includeRaw {
+			q.QueryMessage, _ = state.Req.Pack()
+		}
+		msg.SetType(q, tap.Message_FORWARDER_QUERY)
+		t.TapMessageWithMetadata(ctx, q, state)
+
+		if reply == nil {
+			continue
+		}
+		r := new(tap.Message)
+		msg.SetQueryTime(r, start)
+		msg.SetResponseTime(r, time.Now())
+		if client != nil {
+			_ = msg.SetQueryAddress(r, client)
+		}
+		if upstream != nil {
+			_ = msg.SetResponseAddress(r, upstream)
+		}
+		if t.includeRaw {
+			r.ResponseMessage, _ = reply.Pack()
+		}
+		msg.SetType(r, tap.Message_FORWARDER_RESPONSE)
+		t.TapMessageWithMetadata(ctx, r, state)
+	}
+}
+
+// upstreamAddr returns the address of NetBox if its URL holds an IP address
+func (n *Netbox) upstreamAddr() net.Addr {
+	u, err := url.Parse(n.Url)
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(u.Hostname())
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		port = 443
+		if u.Scheme == "http" {
+			port = 80
+		}
+	}
+	return &net.TCPAddr{IP: ip, Port: port}
+}
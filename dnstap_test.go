@@ -0,0 +1,170 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// fakeTapper collects the tapped messages
+type fakeTapper struct {
+	messages []*tap.Message
+}
+
+func (f *fakeTapper) TapMessageWithMetadata(_ context.Context, m *tap.Message, _ request.Request) {
+	f.messages = append(f.messages, m)
+}
+
+func TestDnstapLookup(t *testing.T) {
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"results": [{"type": "A", "ttl": 8600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.org."}]}`))
+	}))
+	defer netbox.Close()
+	upstream := netbox.Listener.Addr().(*net.TCPAddr)
+
+	tests := []struct {
+		name       string
+		includeRaw bool
+	}{
+		{"with raw messages", true},
+		{"without raw messages", false},
+	}
+
+	for _, tt := range tests {
+		tp := &fakeTapper{}
+		n := newNetbox()
+		n.Url = netbox.URL
+		n.Token = "mytoken"
+		n.Zones = []string{"example.org."}
+		n.UsePlugin = true
+		n.cache = newCache(defaultCacheSize)
+		n.taps = []tapTarget{{tapper: tp, includeRaw: tt.includeRaw}}
+
+		// the second answer is served from the cache and not looked up again
+		for i := 0; i < 2; i++ {
+			r := new(dns.Msg)
+			r.SetQuestion("mail1.example.org.", dns.TypeA)
+			_, err := n.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), r)
+			assert.NoError(t, err, tt.name)
+		}
+
+		if !assert.Len(t, tp.messages, 2, tt.name) {
+			continue
+		}
+		query, response := tp.messages[0], tp.messages[1]
+		assert.Equal(t, tap.Message_FORWARDER_QUERY, query.GetType(), tt.name)
+		assert.Equal(t, tap.Message_FORWARDER_RESPONSE, response.GetType(), tt.name)
+		for _, m := range tp.messages {
+			assert.Equal(t, net.ParseIP("10.240.0.1"), net.IP(m.GetQueryAddress()), tt.name)
+			assert.Equal(t, upstream.IP.To4(), net.IP(m.GetResponseAddress()), tt.name)
+			assert.Equal(t, uint32(upstream.Port), m.GetResponsePort(), tt.name)
+			assert.Equal(t, tap.SocketProtocol_TCP, m.GetSocketProtocol(), tt.name)
+		}
+		assert.NotZero(t, response.GetResponseTimeSec(), tt.name)
+
+		if !tt.includeRaw {
+			assert.Nil(t, query.QueryMessage, tt.name)
+			assert.Nil(t, response.ResponseMessage, tt.name)
+			continue
+		}
+		q := new(dns.Msg)
+		if assert.NoError(t, q.Unpack(query.QueryMessage), tt.name) {
+			assert.Equal(t, "mail1.example.org.", q.Question[0].Name, tt.name)
+		}
+		resp := new(dns.Msg)
+		if assert.NoError(t, resp.Unpack(response.ResponseMessage), tt.name) && assert.Len(t, resp.Answer, 1, tt.name) {
+			assert.Equal(t, "192.168.0.1", resp.Answer[0].(*dns.A).A.String(), tt.name)
+		}
+	}
+}
+
+func TestDnstapLookupFailed(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").Reply(500)
+
+	tp := &fakeTapper{}
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+	n.taps = []tapTarget{{tapper: tp, includeRaw: true}}
+
+	// only the query is tapped, the name of NetBox has no address to tap
+	r := new(dns.Msg)
+	r.SetQuestion("mail1.example.org.", dns.TypeA)
+	_, _ = n.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), r)
+	if assert.Len(t, tp.messages, 1) {
+		assert.Equal(t, tap.Message_FORWARDER_QUERY, tp.messages[0].GetType())
+		assert.Nil(t, tp.messages[0].GetResponseAddress())
+	}
+}
+
+func TestDnstapDisabled(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 8600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.org."}]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+
+	// without dnstap the lookup is not tapped
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("mail1.example.org.", dns.TypeA)
+	_, err := n.ServeDNS(context.Background(), rec, r)
+	assert.NoError(t, err)
+	assert.NotNil(t, rec.Msg)
+}
+
+func TestDnstapLookupRecords(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 8600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.org."}]}`)
+
+	tp := &fakeTapper{}
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+	n.taps = []tapTarget{{tapper: tp, includeRaw: true}}
+
+	// lookups of other plugins have no client to tap the address of
+	records, err := n.LookupRecords(context.Background(), "", "mail1.example.org.", dns.TypeA)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	if assert.Len(t, tp.messages, 2) {
+		assert.Equal(t, tap.Message_FORWARDER_QUERY, tp.messages[0].GetType())
+		assert.Equal(t, tap.Message_FORWARDER_RESPONSE, tp.messages[1].GetType())
+		for _, m := range tp.messages {
+			assert.Nil(t, m.GetQueryAddress())
+		}
+	}
+}
@@ -29,6 +29,125 @@ var requestCount = prometheus.NewCounterVec(prometheus.CounterOpts{
 	Subsystem: "netbox",
 	Name:      "request_count_total",
 	Help:      "Counter of requests made.",
+}, []string{"server", "zone", "qtype"})
+
+// cacheHits exports a prometheus metric that is incremented every time a query is
+// answered from the response cache.
+var cacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "netbox",
+	Name:      "cache_hits_total",
+	Help:      "Counter of requests answered from the response cache.",
+}, []string{"server"})
+
+// cacheMisses exports a prometheus metric that is incremented every time a query is
+// not found in the response cache.
+var cacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "netbox",
+	Name:      "cache_misses_total",
+	Help:      "Counter of requests not found in the response cache.",
+}, []string{"server"})
+
+// cacheEntries exports a prometheus metric with the number of entries held by the
+// response cache.
+var cacheEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "netbox",
+	Name:      "cache_entries",
+	Help:      "The number of entries in the response cache.",
 }, []string{"server"})
 
+// cacheStale exports a prometheus metric that is incremented every time a query is
+// answered from an expired cache entry because NetBox could not be queried.
+var cacheStale = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "netbox",
+	Name:      "cache_stale_total",
+	Help:      "Counter of requests answered from expired cache entries.",
+}, []string{"server"})
+
+// cacheEvictions exports a prometheus metric that is incremented every time the least
+// recently used entry is evicted from the full response cache.
+var cacheEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "netbox",
+	Name:      "cache_evictions_total",
+	Help:      "Counter of entries evicted from the full response cache.",
+}, []string{"server"})
+
+// info exports a prometheus metric set to 1 with the versions of NetBox and the
+// NetBox DNS plugin detected by the last status check and whether the version of
+// the plugin is supported.
+var info = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "netbox",
+	Name:      "info",
+	Help:      "The versions of NetBox and the NetBox DNS plugin in use.",
+}, []string{"netbox_version", "plugin_version", "plugin_compatible"})
+
+// healthy exports a prometheus metric set to 1 if NetBox was reachable at the last
+// status check and to 0 otherwise.
+var healthy = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "netbox",
+	Name:      "healthy",
+	Help:      "Whether NetBox was reachable at the last status check.",
+})
+
+// Endpoint kinds the duration of requests against NetBox is observed for.
+const (
+	endpointRecords     = "records"
+	endpointZones       = "zones"
+	endpointStatus      = "status"
+	endpointIPAddresses = "ip-addresses"
+)
+
+// requestDuration exports a prometheus metric that observes the round-trip time of
+// every request made against NetBox.
+var requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "netbox",
+	Name:      "request_duration_seconds",
+	Buckets:   plugin.TimeBuckets,
+	Help:      "Histogram of the time requests against NetBox took.",
+}, []string{"endpoint"})
+
+// Reasons requests against NetBox are counted as failed for.
+const (
+	errorTimeout         = "timeout"
+	errorBadStatus       = "bad_status"
+	errorDecode          = "decode_error"
+	errorConnection      = "connection"
+	errorRateLimited     = "rate_limited"
+	errorTooManyRequests = "too_many_requests"
+)
+
+// requestErrors exports a prometheus metric that is incremented every time a request
+// against NetBox fails.
+var requestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "netbox",
+	Name:      "request_errors_total",
+	Help:      "Counter of failed requests against NetBox by reason.",
+}, []string{"reason"})
+
+// inflightRequests exports a prometheus metric with the number of requests against
+// NetBox awaiting their response.
+var inflightRequests = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "netbox",
+	Name:      "inflight_requests",
+	Help:      "The number of requests against NetBox awaiting their response.",
+})
+
+// queuedRequests exports a prometheus metric with the number of requests against
+// NetBox waiting for the rate limit.
+var queuedRequests = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "netbox",
+	Name:      "queued_requests",
+	Help:      "The number of requests against NetBox waiting for the rate limit.",
+})
+
 var once sync.Once
@@ -0,0 +1,215 @@
+// Copyright 2020 Oz Tiram <oz.tiram@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// metricValue returns the value of a counter or the sample count of a histogram
+// collected by c with the given labels
+func metricValue(t *testing.T, c prometheus.Collector, labels map[string]string) float64 {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if value, ok := labels[label.GetName()]; ok && value != label.GetValue() {
+					continue metrics
+				}
+			}
+			switch {
+			case m.GetCounter() != nil:
+				return m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				return m.GetGauge().GetValue()
+			case m.GetHistogram() != nil:
+				return float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return 0
+}
+
+func TestRequestDuration(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").Reply(200).BodyString(`{"results": []}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").Reply(200).BodyString(`{"results": []}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+
+	records := metricValue(t, requestDuration, map[string]string{"endpoint": endpointRecords})
+	zones := metricValue(t, requestDuration, map[string]string{"endpoint": endpointZones})
+
+	_, err := n.queryRecord(context.Background(), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	assert.NoError(t, err)
+	_, err = n.queryZone(context.Background(), "example.org.", "")
+	assert.NoError(t, err)
+
+	assert.Equal(t, records+1, metricValue(t, requestDuration, map[string]string{"endpoint": endpointRecords}))
+	assert.Equal(t, zones+1, metricValue(t, requestDuration, map[string]string{"endpoint": endpointZones}))
+}
+
+func TestRequestErrors(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	tests := []struct {
+		name   string
+		reason string
+		mock   func(*gock.Request)
+	}{
+		{"timeout", errorTimeout, func(r *gock.Request) {
+			r.Reply(200).Delay(time.Second).BodyString(`{"results": []}`)
+		}},
+		{"connection", errorConnection, func(r *gock.Request) {
+			r.ReplyError(errors.New("connection refused"))
+		}},
+		{"bad status", errorBadStatus, func(r *gock.Request) {
+			r.Reply(500)
+		}},
+		{"decode error", errorDecode, func(r *gock.Request) {
+			r.Reply(200).BodyString(`{"results": [`)
+		}},
+	}
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Client.Timeout = 50 * time.Millisecond
+
+	for _, tt := range tests {
+		tt.mock(gock.New("https://example.org/api/plugins/netbox-dns/records/"))
+		tt.mock(gock.New("https://example.org/api/plugins/netbox-dns/zones/"))
+
+		before := metricValue(t, requestErrors, map[string]string{"reason": tt.reason})
+
+		_, err := n.queryRecord(context.Background(), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+		assert.Error(t, err, tt.name)
+		_, err = n.queryZone(context.Background(), "example.org.", "")
+		assert.Error(t, err, tt.name)
+
+		assert.Equal(t, before+2, metricValue(t, requestErrors, map[string]string{"reason": tt.reason}), tt.name)
+	}
+}
+
+func TestRequestCountLabels(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").Reply(200).BodyString(`{
+		"results": [
+		{
+			"type": "A",
+			"ttl": 8600,
+			"value": "192.168.0.1",
+			"absolute_value": "192.168.0.1",
+			"fqdn": "mail1.example.org."
+		}]
+	}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+
+	labels := map[string]string{"server": "", "zone": "example.org.", "qtype": "A"}
+	before := metricValue(t, requestCount, labels)
+
+	r := new(dns.Msg)
+	r.SetQuestion("mail1.example.org.", dns.TypeA)
+	_, err := n.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), r)
+	assert.NoError(t, err)
+
+	assert.Equal(t, before+1, metricValue(t, requestCount, labels))
+}
+
+func TestInflightRequests(t *testing.T) {
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		w.Write([]byte(`{"results": []}`))
+	}))
+	defer ts.Close()
+
+	n := newNetbox()
+	n.Url = ts.URL
+	n.Token = "mytoken"
+	// allow a request every 100ms, so the second waits for the rate limit
+	n.limiter = rate.NewLimiter(rate.Every(100*time.Millisecond), 1)
+
+	inflight := metricValue(t, inflightRequests, nil)
+	queued := metricValue(t, queuedRequests, nil)
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := n.query(context.Background(), "host1", familyIP4)
+		done <- err
+	}()
+
+	// the request is counted while NetBox has not answered it yet
+	<-arrived
+	assert.Equal(t, inflight+1, metricValue(t, inflightRequests, nil))
+
+	// the next request is counted while waiting for the rate limit
+	go func() {
+		_, err := n.query(context.Background(), "host2", familyIP4)
+		done <- err
+	}()
+	assert.Eventually(t, func() bool {
+		return metricValue(t, queuedRequests, nil) == queued+1
+	}, time.Second, time.Millisecond)
+
+	release <- struct{}{}
+	<-arrived
+	assert.Equal(t, queued, metricValue(t, queuedRequests, nil))
+	release <- struct{}{}
+
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-done)
+	assert.Equal(t, inflight, metricValue(t, inflightRequests, nil))
+	assert.Equal(t, queued, metricValue(t, queuedRequests, nil))
+}
+
+func TestQTypeLabel(t *testing.T) {
+	assert.Equal(t, "AAAA", qtypeLabel(dns.TypeAAAA))
+	assert.Equal(t, "other", qtypeLabel(65000))
+}
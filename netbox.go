@@ -17,18 +17,27 @@ package netbox
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/trace"
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
+	ot "github.com/opentracing/opentracing-go"
+	"golang.org/x/time/rate"
 )
 
 // Define log to be a logger with the plugin name in it. This way we can just use log.Info and
@@ -36,16 +45,158 @@ import (
 var log = clog.NewWithPlugin("netbox")
 
 type Netbox struct {
-	Url       string
-	Token     string
-	Next      plugin.Handler
-	TTL       time.Duration
-	Fall      fall.F
-	Zones     []string
-	UsePlugin bool
-	Client    *http.Client
+	Url           string
+	APIPrefix     string
+	Token         string
+	Next          plugin.Handler
+	TTL           time.Duration
+	NegativeTTL   time.Duration
+	MinTTL        time.Duration
+	MaxTTL        time.Duration
+	MaxCNAMEDepth int
+	Fall          fall.F
+	// FallthroughOn selects when Fall passes queries on to the next plugin,
+	// one of FallthroughErrors, FallthroughEmpty and FallthroughBoth
+	FallthroughOn string
+	Zones         []string
+	UsePlugin     bool
+	Client        *http.Client
+	Headers       http.Header
+
+	// StatusInterval defines how often Ready is re-run in the background
+	StatusInterval time.Duration
+	// StatusPath overrides the path of the status endpoint used by Ready
+	StatusPath string
+	// QueryTimeout bounds every attempt of a request against NetBox, unlike
+	// the timeout of Client it leaves room for a retry
+	QueryTimeout time.Duration
+	// MaxUpstreamCalls bounds the requests against NetBox a single query may
+	// cause
+	MaxUpstreamCalls int
+	// SOA configures the SOA answered in native mode
+	SOA SOAConfig
+	// Views select the netbox-dns view records are looked up in
+	Views []View
+	// DefaultView is the netbox-dns view used for queries without a trusted
+	// EDNS0 Client Subnet
+	DefaultView string
+	// TrustECS lists the networks of clients whose EDNS0 Client Subnet selects
+	// the view, the source address of all others does
+	TrustECS []*net.IPNet
+	// Tenant restricts lookups to the objects of a NetBox tenant
+	Tenant string
+	// VRF restricts the IP addresses of IPAM to a VRF, given by its ID or
+	// route distinguisher
+	VRF string
+	// ACL allows or denies clients to query, the first matching rule wins
+	ACL []ACLRule
+	// AllowTransfer lists the networks of clients allowed to request AXFR
+	AllowTransfer []*net.IPNet
+	// FlattenCNAME answers A and AAAA queries with the addresses CNAME chains
+	// end in instead of the chain
+	FlattenCNAME bool
+	// RoundRobin rotates the addresses of answers between responses
+	RoundRobin bool
+	// SynthesizePTR answers PTR queries in native mode from the forward
+	// records of an address if IPAM has no dns_name for it
+	SynthesizePTR bool
+	// Mode forces answering from the NetBox DNS plugin or from IPAM instead
+	// of detecting the plugin, one of ModeAuto, ModePlugin and ModeNative
+	Mode string
+	// RefuseOutsideZones answers queries outside of Zones with REFUSED if
+	// there is no next plugin to pass them on to
+	RefuseOutsideZones bool
+	// AutoZones adds the active zones of the NetBox DNS plugin to Zones
+	AutoZones bool
+	// PageSize requests pages of this size from the NetBox DNS plugin
+	PageSize int
+	// UserAgent overrides the User-Agent header sent to NetBox
+	UserAgent string
+	// ServeStale is how long expired cache entries are served when NetBox
+	// can not be queried
+	ServeStale time.Duration
+	// AliasCustomField names the custom field of IP addresses holding a name
+	// answered in native mode with a CNAME to their dns_name
+	AliasCustomField string
+	// TXTCustomField names the custom field of IP addresses holding the text
+	// of the TXT record of their dns_name answered in native mode
+	TXTCustomField string
+	// TTLCustomField names the NetBox custom field of records overriding
+	// their TTL if set
+	TTLCustomField string
+	// IncludeInactive serves the inactive records and zones of the NetBox DNS
+	// plugin as well
+	IncludeInactive bool
+	// DNSSEC adds the RRSIG records of pre-signed zones to the answers of
+	// clients setting the DO bit, or signs them if keys are configured
+	DNSSEC bool
+	// LogQueries logs every request against NetBox and every looked up
+	// question at debug level
+	LogQueries bool
+
+	cache      *cache
+	rotation   atomic.Uint64
+	health     atomic.Bool
+	checking   atomic.Bool
+	limiter    *rate.Limiter
+	requests   map[string]*sharedCall
+	requestsMu sync.Mutex
+	served     []string
+	mu         sync.RWMutex
+	etags      map[string]etagEntry
+	etagMu     sync.Mutex
+	taps       []tapTarget
+	tracer     trace.Trace
+	keys       []*signingKey
+	stop       chan struct{}
+	stopped    chan struct{}
+}
+
+// SOAConfig holds the values of the SOA answered in native mode, zero values
+// are replaced by defaults
+type SOAConfig struct {
+	MName   string
+	RName   string
+	Refresh time.Duration
+	Retry   time.Duration
+	Expire  time.Duration
+	Minimum time.Duration
 }
 
+// default timers of the SOA answered in native mode
+const (
+	defaultSOARefresh = 2 * time.Hour
+	defaultSOARetry   = 30 * time.Minute
+	defaultSOAExpire  = 24 * time.Hour
+	defaultSOAMinimum = 30 * time.Second
+)
+
+// modes select where answers are looked up, ModeAuto uses the NetBox DNS
+// plugin if Ready finds it installed
+const (
+	ModeAuto   = "auto"
+	ModePlugin = "plugin"
+	ModeNative = "native"
+)
+
+// fallthrough modes select the outcomes of a lookup Fall passes on to the next
+// plugin, FallthroughErrors when NetBox can not be queried, FallthroughEmpty
+// when it has no records for the question
+const (
+	FallthroughErrors = "errors"
+	FallthroughEmpty  = "empty"
+	FallthroughBoth   = "both"
+)
+
+// glueQuerySet selects the addresses placed in the additional section
+const glueQuerySet DNSQuerySet = "type=A&type=AAAA"
+
+// maxGlueHosts limits the hosts looked up for the additional section of an answer
+const maxGlueHosts = 8
+
+// maxCNAMEWorkers limits the CNAME targets of a query looked up concurrently
+const maxCNAMEWorkers = 4
+
 // constants to match IP address family used by NetBox
 const (
 	familyIP4 = 4
@@ -54,33 +205,67 @@ const (
 
 // ServeDNS implements the plugin.Handler interface
 func (n *Netbox) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
-	var (
-		err error
-	)
-
 	state := request.Request{W: w, Req: r}
 
 	// only handle zones we are configured to respond for
-	zone := plugin.Zones(n.Zones).Matches(state.Name())
+	zone := plugin.Zones(n.servedZones()).Matches(state.Name())
 	if zone == "" {
+		// authoritative-only servers refuse questions outside of their zones
+		// explicitly instead of failing for the lack of a next plugin
+		if n.RefuseOutsideZones && n.Next == nil {
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeRefused)
+			_ = w.WriteMsg(m)
+			return dns.RcodeSuccess, nil
+		}
 		return plugin.NextOrFailure(n.Name(), n.Next, ctx, w, r)
 	}
 
+	// trace the handling of the request if a tracer is configured
+	if span := startSpan(ctx, "netbox", zone); span != nil {
+		defer span.Finish()
+		ctx = ot.ContextWithSpan(ctx, span)
+	}
+
 	// Export metric with the server label set to the current
 	// server handling the request.
-	requestCount.WithLabelValues(metrics.WithServer(ctx)).Inc()
+	server := metrics.WithServer(ctx)
+	requestCount.WithLabelValues(server, zone, qtypeLabel(state.QType())).Inc()
 
-	var answers []dns.RR
+	// refuse denied clients before asking NetBox anything
+	if !n.allowed(state) {
+		return dnserror(dns.RcodeRefused, state, nil)
+	}
 
-	if n.UsePlugin {
-		answers, err = n.queryDNSPlugin(zone, state)
-	} else {
-		answers, err = n.queryNative(state)
+	view := n.view(state)
+
+	// zone transfers are streamed directly and never cached
+	if state.QType() == dns.TypeAXFR {
+		return n.transfer(ctx, zone, view, state)
+	}
+
+	// the keys of signed zones are served from the configuration
+	if keys := n.signingKeys(zone); len(keys) > 0 && state.QType() == dns.TypeDNSKEY && state.Name() == zone {
+		return n.answerDNSKEY(state, keys)
+	}
+
+	// bound the requests against NetBox the query may cause
+	ctx = withBudget(ctx, n.MaxUpstreamCalls)
+
+	// answer from the response cache if enabled
+	answers, extra, cached, err := n.lookup(ctx, zone, view, state)
+	if n.cache != nil {
+		if cached {
+			cacheHits.WithLabelValues(server).Inc()
+		} else {
+			cacheMisses.WithLabelValues(server).Inc()
+		}
+		cacheEntries.WithLabelValues(server).Set(float64(n.cache.len()))
 	}
 
 	if err != nil {
-		// always fallthrough if configured
-		if n.Fall.Through(state.Name()) {
+		// fallthrough if configured for errors
+		if n.fallsThrough(state.Name(), true) {
 			return plugin.NextOrFailure(n.Name(), n.Next, ctx, w, r)
 		}
 
@@ -89,10 +274,32 @@ func (n *Netbox) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	}
 
 	if len(answers) == 0 {
-		if n.Fall.Through(state.Name()) {
+		if n.fallsThrough(state.Name(), false) {
 			return plugin.NextOrFailure(n.Name(), n.Next, ctx, w, r)
 		} else {
-			return dnserror(dns.RcodeNameError, state, nil)
+			// a name with records of other types only is answered with NODATA
+			rcode := dns.RcodeNameError
+			types := n.types(ctx, zone, view, state)
+			if len(types) > 0 {
+				rcode = dns.RcodeSuccess
+			}
+			return n.negative(ctx, rcode, zone, view, state, types)
+		}
+	}
+
+	if n.RoundRobin {
+		answers = rotate(answers, n.rotation.Add(1))
+	}
+
+	// sign answers on the fly if keys are configured for the zone, otherwise
+	// pass the signatures of pre-signed zones on to clients asking for them
+	if n.DNSSEC && state.Do() {
+		if keys := n.signingKeys(zone); len(keys) > 0 {
+			now := time.Now()
+			answers = sign(keys, answers, now)
+			extra = sign(keys, extra, now)
+		} else if n.usePlugin() {
+			answers = append(slices.Clone(answers), n.signatures(ctx, zone, view, state, answers)...)
 		}
 	}
 
@@ -101,6 +308,12 @@ func (n *Netbox) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	m.SetReply(r)
 	m.Authoritative = true
 	m.Answer = answers
+	m.Extra = extra
+	state.SizeAndDo(m)
+
+	// answers exceeding the UDP buffer of the client are truncated with the
+	// TC bit set, so it retries over TCP
+	m.Truncate(state.Size())
 
 	// send response back to client
 	_ = w.WriteMsg(m)
@@ -109,35 +322,388 @@ func (n *Netbox) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	return dns.RcodeSuccess, nil
 }
 
+// lookup returns the answers and additional records for the question of state
+// within zone and whether they were taken from the response cache. Answers
+// are looked up in NetBox and cached if the cache is disabled or misses.
+func (n *Netbox) lookup(ctx context.Context, zone, view string, state request.Request) (answers, extra []dns.RR, cached bool, err error) {
+	key := cacheKey{zone: zone, view: view, name: state.Name(), qtype: state.QType()}
+	answers, extra, cached = n.cache.get(key)
+	if cached {
+		return answers, extra, true, nil
+	}
+
+	start := time.Now()
+	if n.usePlugin() {
+		answers, err = n.queryDNSPlugin(ctx, zone, view, state)
+	} else {
+		answers, err = n.queryNative(ctx, zone, state)
+	}
+	if n.LogQueries {
+		log.Debugf("lookup of %s %s in zone %s returned %d records in %s", state.Name(), state.Type(), zone, len(answers), time.Since(start))
+	}
+	if len(n.taps) > 0 {
+		n.tapLookup(ctx, state, answers, err, start)
+	}
+	if err == nil {
+		if len(answers) > 0 {
+			extra = n.glue(ctx, zone, view, answers)
+			countEviction(ctx, n.cache.set(key, answers, extra))
+		} else if n.cache != nil {
+			countEviction(ctx, n.cache.setNegative(key, n.negativeTTL(ctx, zone, view)))
+		}
+	} else if staleAnswers, staleExtra, ok := n.cache.getStale(key); ok {
+		// rather answer with an expired entry than fail
+		log.Warningf("serving stale answer for %s %s: %s", state.Name(), state.Type(), err)
+		cacheStale.WithLabelValues(metrics.WithServer(ctx)).Inc()
+		answers, extra, err = staleAnswers, staleExtra, nil
+	}
+	return answers, extra, false, err
+}
+
+// LookupRecords returns the records of type qtype of fqdn within zone like
+// they are answered to a query without EDNS0 Client Subnet, CNAMEs and
+// wildcards included. Without zone the configured zone fqdn is within is used.
+// Both are canonicalized, the returned records are copies owned by the caller.
+func (n *Netbox) LookupRecords(ctx context.Context, zone, fqdn string, qtype uint16) ([]dns.RR, error) {
+	fqdn = dns.CanonicalName(fqdn)
+	if zone == "" {
+		zone = plugin.Zones(n.servedZones()).Matches(fqdn)
+		if zone == "" {
+			return nil, fmt.Errorf("%s is not within a configured zone", fqdn)
+		}
+	}
+	zone = dns.CanonicalName(zone)
+	if !dns.IsSubDomain(zone, fqdn) {
+		return nil, fmt.Errorf("%s is not within zone %s", fqdn, zone)
+	}
+
+	r := new(dns.Msg)
+	r.SetQuestion(fqdn, qtype)
+	state := request.Request{Req: r}
+
+	answers, _, _, err := n.lookup(withBudget(ctx, n.MaxUpstreamCalls), zone, n.view(state), state)
+	if err != nil {
+		return nil, err
+	}
+
+	// the answers may be held by the response cache
+	records := make([]dns.RR, 0, len(answers))
+	for _, rr := range answers {
+		records = append(records, dns.Copy(rr))
+	}
+	return records, nil
+}
+
+// types returns the types of the records the name of state has within zone,
+// none if the name does not exist. The names are looked up like any other
+// question, the apex always has its SOA and NS records.
+func (n *Netbox) types(ctx context.Context, zone, view string, state request.Request) []uint16 {
+	qname := state.Name()
+	var types []uint16
+	if qname == zone {
+		types = append(types, dns.TypeSOA, dns.TypeNS)
+		if len(n.signingKeys(zone)) > 0 {
+			types = append(types, dns.TypeDNSKEY)
+		}
+	}
+
+	qtypes := []uint16{dns.TypeANY}
+	if !n.usePlugin() {
+		// IPAM only knows the addresses of names
+		qtypes = []uint16{dns.TypeA, dns.TypeAAAA}
+	}
+	for _, qtype := range qtypes {
+		if qtype == state.QType() {
+			continue
+		}
+		answers, _, _, err := n.lookup(ctx, zone, view, state.NewWithQuestion(qname, qtype))
+		if err != nil {
+			continue
+		}
+		for _, rr := range answers {
+			t := rr.Header().Rrtype
+			if dns.CanonicalName(rr.Header().Name) == qname && !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
 // Name implements the Handler interface.
 func (n *Netbox) Name() string { return "netbox" }
 
-func (n *Netbox) queryNative(state request.Request) ([]dns.RR, error) {
+// fallsThrough reports whether the query for name is passed on to the next
+// plugin, failed tells NetBox could not be queried rather than has no records
+func (n *Netbox) fallsThrough(name string, failed bool) bool {
+	switch n.FallthroughOn {
+	case FallthroughErrors:
+		if !failed {
+			return false
+		}
+	case FallthroughEmpty:
+		if failed {
+			return false
+		}
+	}
+	return n.Fall.Through(name)
+}
+
+// qtypeLabel returns the textual type of qtype for metric labels, unknown
+// types are grouped to keep the cardinality bounded
+func qtypeLabel(qtype uint16) string {
+	if t, ok := dns.TypeToString[qtype]; ok {
+		return t
+	}
+	return "other"
+}
+
+// negativeTTL returns how long a negative answer within zone may be cached.
+// Without a configured negative TTL the SOA minimum of the zone is used.
+func (n *Netbox) negativeTTL(ctx context.Context, zone, view string) time.Duration {
+	if n.NegativeTTL > 0 {
+		return n.NegativeTTL
+	}
+	if !n.usePlugin() {
+		return 0
+	}
+
+	soa := n.authoritySOA(ctx, zone, view)
+	if soa == nil {
+		return 0
+	}
+	return time.Duration(soa.Header().Ttl) * time.Second
+}
+
+// defaultTTL returns the TTL of a record of name without a TTL of its own,
+// which is the SOA minimum of the zone holding name or the configured TTL if
+// the SOA can not be fetched. The TTLs are remembered per zone in defaults.
+func (n *Netbox) defaultTTL(ctx context.Context, zone, view, name string, defaults map[string]uint32) uint32 {
+	zone = n.zoneOf(zone, dns.CanonicalName(name))
+	if ttl, ok := defaults[zone]; ok {
+		return ttl
+	}
+	ttl := uint32(n.TTL.Seconds())
+	if n.usePlugin() {
+		if soa, ok := n.authoritySOA(ctx, zone, view).(*dns.SOA); ok {
+			ttl = soa.Minttl
+		}
+	}
+	defaults[zone] = ttl
+	return ttl
+}
+
+// authoritySOA returns the SOA of zone for the authority section of negative
+// answers, its TTL is lowered to the SOA minimum. The SOA is kept in the
+// response cache if enabled, nil is returned if it can not be fetched.
+func (n *Netbox) authoritySOA(ctx context.Context, zone, view string) dns.RR {
+	key := cacheKey{zone: zone, view: view, name: zone, qtype: dns.TypeSOA}
+	answers, _, ok := n.cache.get(key)
+	if !ok {
+		var soa dns.RR
+		if n.usePlugin() {
+			zones, err := n.queryZone(ctx, zone, view)
+			if err != nil || len(zones) == 0 {
+				log.Debugf("could not fetch SOA of %s: %v", zone, err)
+				return nil
+			}
+			soa = zones[0].RR()
+			soa.Header().Ttl = n.clampTTL(soa.Header().Ttl)
+		} else {
+			var err error
+			if soa, err = n.nativeSOA(ctx, zone, n.clampTTL(uint32(n.TTL.Seconds()))); err != nil {
+				log.Debugf("could not fetch SOA of %s: %v", zone, err)
+				return nil
+			}
+		}
+		answers = []dns.RR{soa}
+		countEviction(ctx, n.cache.set(key, answers, nil))
+		answers = []dns.RR{dns.Copy(soa)}
+	}
+	soa, ok := answers[0].(*dns.SOA)
+	if !ok {
+		return nil
+	}
+	soa.Hdr.Ttl = min(soa.Hdr.Ttl, soa.Minttl)
+	return soa
+}
+
+// clampTTL raises ttl to MinTTL if it is below and caps it at MaxTTL if set
+func (n *Netbox) clampTTL(ttl uint32) uint32 {
+	ttl = max(ttl, uint32(n.MinTTL.Seconds()))
+	if n.MaxTTL > 0 {
+		ttl = min(ttl, uint32(n.MaxTTL.Seconds()))
+	}
+	return ttl
+}
+
+func (n *Netbox) queryNative(ctx context.Context, zone string, state request.Request) ([]dns.RR, error) {
 	var (
 		ips     []net.IP
 		domains []string
+		texts   []string
 		answers []dns.RR
 		err     error
 	)
 	qname := state.Name()
-	// check record type here and bail out if not A, AAAA or PTR
+	ttl := n.clampTTL(uint32(n.TTL.Seconds()))
+	// check record type here and bail out if not A, AAAA, PTR, SOA or the
+	// types of configured custom fields
 	switch state.QType() {
 	case dns.TypeA:
-		ips, err = n.query(strings.TrimRight(qname, "."), familyIP4)
-		answers = a(qname, uint32(n.TTL.Seconds()), ips)
+		ips, err = n.query(ctx, strings.TrimRight(qname, "."), familyIP4)
+		answers = a(qname, ttl, ips)
+		if err == nil && len(answers) == 0 {
+			answers, err = n.nativeAlias(ctx, qname, ttl, familyIP4)
+		}
 	case dns.TypeAAAA:
-		ips, err = n.query(strings.TrimRight(qname, "."), familyIP6)
-		answers = aaaa(qname, uint32(n.TTL.Seconds()), ips)
+		ips, err = n.query(ctx, strings.TrimRight(qname, "."), familyIP6)
+		answers = aaaa(qname, ttl, ips)
+		if err == nil && len(answers) == 0 {
+			answers, err = n.nativeAlias(ctx, qname, ttl, familyIP6)
+		}
+	case dns.TypeCNAME:
+		if n.AliasCustomField == "" {
+			return nil, fmt.Errorf("request type not implemented")
+		}
+		answers, err = n.nativeAlias(ctx, qname, ttl, 0)
+	case dns.TypeTXT:
+		if n.TXTCustomField == "" {
+			return nil, fmt.Errorf("request type not implemented")
+		}
+		texts, err = n.querytxt(ctx, qname)
+		answers = txt(qname, ttl, texts)
 	case dns.TypePTR:
-		domains, err = n.queryreverse(qname)
-		answers = ptr(qname, uint32(n.TTL.Seconds()), domains)
+		domains, err = n.queryreverse(ctx, qname)
+		answers = ptr(qname, ttl, domains)
+	case dns.TypeSOA:
+		// IPAM knows nothing about zones, the SOA is built from the config
+		if qname == zone {
+			var soa dns.RR
+			soa, err = n.nativeSOA(ctx, zone, ttl)
+			if err == nil {
+				answers = []dns.RR{soa}
+			}
+		}
 	default:
 		return nil, fmt.Errorf("request type not implemented")
 	}
 	return answers, err
 }
 
-func (n *Netbox) queryDNSPlugin(zone string, state request.Request) ([]dns.RR, error) {
+// nativeAlias returns the CNAME of qname to the IP addresses holding it in
+// their custom field AliasCustomField, followed by their addresses of family
+func (n *Netbox) nativeAlias(ctx context.Context, qname string, ttl uint32, family int) ([]dns.RR, error) {
+	if n.AliasCustomField == "" {
+		return nil, nil
+	}
+	target, ips, err := n.queryalias(ctx, qname, family)
+	if err != nil || target == "" {
+		return nil, err
+	}
+
+	answers := []dns.RR{&dns.CNAME{
+		Hdr:    dns.RR_Header{Name: qname, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: ttl},
+		Target: target,
+	}}
+	switch family {
+	case familyIP4:
+		answers = append(answers, a(target, ttl, ips)...)
+	case familyIP6:
+		answers = append(answers, aaaa(target, ttl, ips)...)
+	}
+	return answers, nil
+}
+
+// nativeSOA returns the SOA of zone built from the soa directive, unset
+// values are replaced by defaults. The serial is the time an IP address was
+// changed last, so it stays the same as long as IPAM does.
+func (n *Netbox) nativeSOA(ctx context.Context, zone string, ttl uint32) (dns.RR, error) {
+	serial, err := n.queryserial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mname, rname := n.SOA.MName, n.SOA.RName
+	if mname == "" {
+		mname = dnsutil.Join("ns.dns", zone)
+	}
+	if rname == "" {
+		rname = dnsutil.Join("hostmaster", zone)
+	}
+	timer := func(d, def time.Duration) uint32 {
+		if d == 0 {
+			d = def
+		}
+		return uint32(d.Seconds())
+	}
+
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+		Ns:      mname,
+		Mbox:    rname,
+		Serial:  serial,
+		Refresh: timer(n.SOA.Refresh, defaultSOARefresh),
+		Retry:   timer(n.SOA.Retry, defaultSOARetry),
+		Expire:  timer(n.SOA.Expire, defaultSOAExpire),
+		Minttl:  timer(n.SOA.Minimum, defaultSOAMinimum),
+	}, nil
+}
+
+// queryWildcard looks up the wildcard records matching fqdn as of RFC 4592.
+// Records are only synthesized for names which do not exist, from the
+// wildcard below their closest encloser, the nearest ancestor which exists.
+// The owner of the returned records is rewritten to fqdn.
+func (n *Netbox) queryWildcard(ctx context.Context, zone, view, fqdn string, querySet DNSQuerySet) ([]DNSRecord, error) {
+	exists, err := n.nameExists(ctx, zone, view, fqdn)
+	if err != nil || exists {
+		return nil, err
+	}
+
+	for name := fqdn; name != zone; {
+		i, end := dns.NextLabel(name, 0)
+		if end {
+			break
+		}
+		name = name[i:]
+
+		exists, err := n.nameExists(ctx, zone, view, name)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		records, err := n.queryRecord(ctx, zone, view, "*."+name, querySet)
+		if err != nil {
+			return nil, err
+		}
+		for i := range records {
+			records[i].FQDN = fqdn
+		}
+		return records, nil
+	}
+	return nil, nil
+}
+
+// nameExists reports whether name has records of any type within zone or is
+// an empty non-terminal with records below it. The apex always exists.
+func (n *Netbox) nameExists(ctx context.Context, zone, view, name string) (bool, error) {
+	if name == zone {
+		return true, nil
+	}
+	records, err := n.queryRecord(ctx, zone, view, name, DNSQuerySetANY)
+	if err != nil {
+		return false, err
+	}
+	if len(records) > 0 {
+		return true, nil
+	}
+	return n.hasDescendants(ctx, zone, view, name)
+}
+
+func (n *Netbox) queryDNSPlugin(ctx context.Context, zone, view string, state request.Request) ([]dns.RR, error) {
 	var (
 		records []DNSRecord
 		zones   []DNSZone
@@ -147,31 +713,241 @@ func (n *Netbox) queryDNSPlugin(zone string, state request.Request) ([]dns.RR, e
 	qname := state.Name()
 	qtype := state.QType()
 
+	var querySet DNSQuerySet
 	if qtype == dns.TypeSOA {
-		zones, err = n.queryZone(zone)
+		zones, err = n.queryZone(ctx, zone, view)
 	} else {
-		querySet, OK := DNSQueryReverseMap[qtype]
+		var OK bool
+		querySet, OK = DNSQueryReverseMap[qtype]
 		if !OK {
 			return nil, fmt.Errorf("request type not implemented")
 		}
-		records, err = n.queryRecord(zone, qname, querySet)
+		records, err = n.queryRecord(ctx, zone, view, qname, querySet)
+		if err == nil && len(records) == 0 {
+			records, err = n.queryWildcard(ctx, zone, view, qname, querySet)
+		}
+	}
+
+	// follow the CNAMEs of A and AAAA queries
+	if qtype == dns.TypeA || qtype == dns.TypeAAAA {
+		records = n.resolveCNAMEs(ctx, zone, view, qname, qtype, records)
 	}
 
+	defaults := make(map[string]uint32)
 	for _, record := range records {
-		// try to resolve CNAME record if question was A or AAAA
-		if record.Type == DNSRecordTypeCNAME && (qtype == dns.TypeA || qtype == dns.TypeAAAA) {
-			if resolvedRecs, err := n.queryRecord(zone, record.AbsoluteValue, DNSQueryReverseMap[qtype]); err == nil {
-				records = append(records, resolvedRecs...)
-			}
+		// drop records NetBox returned although they were not asked for,
+		// they would end up as NULL records in the answer
+		if _, ok := DNSRecordReverseMap[record.Type]; !ok || !querySet.Contains(record.Type) {
+			log.Warningf("dropping %s record of %s not matching %q", record.Type, record.FQDN, querySet)
+			continue
+		}
+		if record.TTL == 0 {
+			record.TTL = n.defaultTTL(ctx, zone, view, record.FQDN, defaults)
 		}
-		answers = append(answers, record.RR())
+		rr := record.RR()
+		rr.Header().Ttl = n.clampTTL(rr.Header().Ttl)
+		answers = append(answers, rr)
 	}
 	for _, zone := range zones {
-		answers = append(answers, zone.RR())
+		rr := zone.RR()
+		rr.Header().Ttl = n.clampTTL(rr.Header().Ttl)
+		answers = append(answers, rr)
+	}
+	// fall back to the name servers of the zone if no NS records are kept
+	// for its apex
+	if qtype == dns.TypeNS && qname == zone && len(answers) == 0 && err == nil {
+		apex, zerr := n.queryZone(ctx, zone, view)
+		if zerr != nil {
+			return answers, zerr
+		}
+		for _, z := range apex {
+			for _, rr := range z.NS() {
+				rr.Header().Ttl = n.clampTTL(rr.Header().Ttl)
+				answers = append(answers, rr)
+			}
+		}
+	}
+	if n.FlattenCNAME && (qtype == dns.TypeA || qtype == dns.TypeAAAA) {
+		answers = flatten(qname, qtype, answers)
 	}
 	return answers, err
 }
 
+// resolveCNAMEs returns records followed by the records their CNAMEs lead to.
+// Records resolved from CNAMEs are appended and visited as well, this way
+// whole chains are followed up to the configured depth. The targets of the
+// CNAMEs of a round are looked up concurrently by at most maxCNAMEWorkers,
+// their records are appended in the order of the CNAMEs.
+func (n *Netbox) resolveCNAMEs(ctx context.Context, zone, view, qname string, qtype uint16, records []DNSRecord) []DNSRecord {
+	depth := 0
+	exhausted := false
+	for visited := 0; visited < len(records); {
+		var targets []string
+		for _, record := range records[visited:] {
+			if record.Type != DNSRecordTypeCNAME {
+				continue
+			}
+			if depth >= n.MaxCNAMEDepth {
+				log.Warningf("CNAME chain for %s truncated after %d records", qname, n.MaxCNAMEDepth)
+				break
+			}
+			depth++
+			targets = append(targets, record.AbsoluteValue)
+		}
+		visited = len(records)
+
+		resolved := make([][]DNSRecord, len(targets))
+		errs := make([]error, len(targets))
+		workers := make(chan struct{}, maxCNAMEWorkers)
+		var wg sync.WaitGroup
+		for i, target := range targets {
+			wg.Add(1)
+			workers <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-workers }()
+				resolved[i], errs[i] = n.queryRecord(ctx, n.zoneOf(zone, target), view, target, DNSQueryReverseMap[qtype])
+			}()
+		}
+		wg.Wait()
+
+		for i := range targets {
+			if errs[i] == nil {
+				records = append(records, resolved[i]...)
+			} else if errors.Is(errs[i], errBudgetExhausted) && !exhausted {
+				exhausted = true
+				log.Warningf("CNAME chain for %s cut off after %d requests against NetBox", qname, n.MaxUpstreamCalls)
+			}
+		}
+	}
+	return records
+}
+
+// glue returns the addresses of the hosts NS and MX answers refer to for the
+// additional section. Only hosts within zone are looked up, at most
+// maxGlueHosts of them, and their addresses are not expanded any further.
+func (n *Netbox) glue(ctx context.Context, zone, view string, answers []dns.RR) []dns.RR {
+	if !n.usePlugin() {
+		return nil
+	}
+
+	var extra []dns.RR
+	seen := make(map[string]bool)
+	defaults := make(map[string]uint32)
+	for _, answer := range answers {
+		var host string
+		switch rr := answer.(type) {
+		case *dns.NS:
+			host = rr.Ns
+		case *dns.MX:
+			host = rr.Mx
+		default:
+			continue
+		}
+		host = dns.CanonicalName(host)
+		if seen[host] || !dns.IsSubDomain(zone, host) || len(seen) >= maxGlueHosts {
+			continue
+		}
+		seen[host] = true
+
+		records, err := n.queryRecord(ctx, n.zoneOf(zone, host), view, host, glueQuerySet)
+		if err != nil {
+			log.Debugf("could not look up glue for %s: %s", host, err)
+			continue
+		}
+		for _, record := range records {
+			if record.Type != DNSRecordTypeA && record.Type != DNSRecordTypeAAAA {
+				continue
+			}
+			if record.TTL == 0 {
+				record.TTL = n.defaultTTL(ctx, zone, view, record.FQDN, defaults)
+			}
+			rr := record.RR()
+			rr.Header().Ttl = n.clampTTL(rr.Header().Ttl)
+			extra = append(extra, rr)
+		}
+	}
+	return extra
+}
+
+// signatures returns the RRSIG records covering the RRsets of answers. They
+// are looked up like any other question, so they are cached as well.
+func (n *Netbox) signatures(ctx context.Context, zone, view string, state request.Request, answers []dns.RR) []dns.RR {
+	var sigs []dns.RR
+	seen := make(map[string]bool)
+	for _, answer := range answers {
+		owner := answer.Header().Name
+		if seen[owner] {
+			continue
+		}
+		seen[owner] = true
+
+		rrs, _, _, err := n.lookup(ctx, n.zoneOf(zone, owner), view, state.NewWithQuestion(owner, dns.TypeRRSIG))
+		if err != nil {
+			log.Debugf("could not look up signatures of %s: %s", owner, err)
+			continue
+		}
+		for _, rr := range rrs {
+			sig, ok := rr.(*dns.RRSIG)
+			if !ok {
+				continue
+			}
+			covered := slices.ContainsFunc(answers, func(answer dns.RR) bool {
+				return answer.Header().Name == owner && answer.Header().Rrtype == sig.TypeCovered
+			})
+			if covered {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	return sigs
+}
+
+// rotate returns answers with its A and its AAAA records rotated by offset.
+// Records of other types keep their position, so CNAMEs stay in front of the
+// addresses they lead to. answers itself may be shared with the cache and is
+// left untouched.
+func rotate(answers []dns.RR, offset uint64) []dns.RR {
+	rotated := slices.Clone(answers)
+	for _, rrtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		var positions []int
+		for i, rr := range answers {
+			if rr.Header().Rrtype == rrtype {
+				positions = append(positions, i)
+			}
+		}
+		k := 0
+		if len(positions) > 0 {
+			k = int(offset % uint64(len(positions)))
+		}
+		for j, i := range positions {
+			rotated[i] = answers[positions[(j+k)%len(positions)]]
+		}
+	}
+	return rotated
+}
+
+// flatten replaces a CNAME chain in answers by the addresses it ends in. They
+// are renamed to qname and valid no longer than any CNAME of the chain.
+func flatten(qname string, qtype uint16, answers []dns.RR) []dns.RR {
+	ttl := uint32(math.MaxUint32)
+	for _, rr := range answers {
+		if rr.Header().Rrtype == dns.TypeCNAME {
+			ttl = min(ttl, rr.Header().Ttl)
+		}
+	}
+	flattened := make([]dns.RR, 0, len(answers))
+	for _, rr := range answers {
+		if rr.Header().Rrtype != qtype {
+			continue
+		}
+		rr.Header().Name = qname
+		rr.Header().Ttl = min(rr.Header().Ttl, ttl)
+		flattened = append(flattened, rr)
+	}
+	return flattened
+}
+
 // a takes a slice of net.IPs and returns a slice of A RRs.
 func a(zone string, ttl uint32, ips []net.IP) []dns.RR {
 	answers := make([]dns.RR, len(ips))
@@ -196,6 +972,18 @@ func aaaa(zone string, ttl uint32, ips []net.IP) []dns.RR {
 	return answers
 }
 
+// txt takes a slice of strings and returns a slice of TXT RRs.
+func txt(zone string, ttl uint32, texts []string) []dns.RR {
+	answers := make([]dns.RR, len(texts))
+	for i, text := range texts {
+		r := new(dns.TXT)
+		r.Hdr = dns.RR_Header{Name: zone, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl}
+		r.Txt = splitTXT(text)
+		answers[i] = r
+	}
+	return answers
+}
+
 // ptr takes a slice of strings and returns a slice of PTR RRs.
 func ptr(zone string, ttl uint32, domains []string) []dns.RR {
 
@@ -210,6 +998,54 @@ func ptr(zone string, ttl uint32, domains []string) []dns.RR {
 	return answers
 }
 
+// negative writes a negative response with rcode. The SOA of zone is added to
+// the authority section to tell resolvers how long to cache the response,
+// types are the types of the records the name has for the proof of signed zones.
+func (n *Netbox) negative(ctx context.Context, rcode int, zone, view string, state request.Request, types []uint16) (int, error) {
+	m := new(dns.Msg)
+	m.SetRcode(state.Req, rcode)
+	m.Authoritative = true
+	var ttl uint32
+	if soa := n.authoritySOA(ctx, zone, view); soa != nil {
+		m.Ns = []dns.RR{soa}
+		ttl = soa.Header().Ttl
+	}
+
+	// prove the denial with an NSEC record claiming the name exists without
+	// records of the queried type, so NXDOMAIN is answered as NODATA
+	if keys := n.signingKeys(zone); n.DNSSEC && state.Do() && len(keys) > 0 {
+		m.Ns = append(m.Ns, denial(state.Name(), types, ttl))
+		m.Ns = sign(keys, m.Ns, time.Now())
+		m.Rcode = dns.RcodeSuccess
+	}
+	state.SizeAndDo(m)
+
+	// send response
+	_ = state.W.WriteMsg(m)
+
+	// return success as the rcode to signal we have written to the client.
+	return dns.RcodeSuccess, nil
+}
+
+// answerDNSKEY answers the DNSKEY query of state with keys, signed if the
+// client sets the DO bit
+func (n *Netbox) answerDNSKEY(state request.Request, keys []*signingKey) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Authoritative = true
+	m.Answer = dnskeys(keys, n.clampTTL(uint32(n.TTL.Seconds())))
+	if state.Do() {
+		m.Answer = sign(keys, m.Answer, time.Now())
+	}
+	state.SizeAndDo(m)
+
+	// send response
+	_ = state.W.WriteMsg(m)
+
+	// return success as the rcode to signal we have written to the client.
+	return dns.RcodeSuccess, nil
+}
+
 // dnserror writes a DNS error response back to the client. Based on plugin.BackendError
 func dnserror(rcode int, state request.Request, err error) (int, error) {
 	m := new(dns.Msg)
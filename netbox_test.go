@@ -17,6 +17,7 @@ package netbox
 
 import (
 	"context"
+	"slices"
 	"testing"
 	"time"
 
@@ -100,3 +101,290 @@ func TestReverseNetbox(t *testing.T) {
 	}
 
 }
+
+func TestNetboxMinTTL(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"dns_name": "my_host"}).Reply(
+		200).BodyString(hostWithIPv4)
+	nb := newNetbox()
+	nb.Url = "https://example.org"
+	nb.Token = "s3kr3tt0ken"
+	nb.TTL = 5 * time.Second
+	nb.MinTTL = time.Minute
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("my_host.", dns.TypeA)
+
+	_, err := nb.ServeDNS(context.Background(), rec, r)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	TTL := rec.Msg.Answer[0].Header().Ttl
+	if TTL != 60 {
+		t.Errorf("Expected TTL %v, got %v", 60, TTL)
+	}
+}
+
+func TestNetboxMaxTTL(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"dns_name": "my_host"}).Reply(
+		200).BodyString(hostWithIPv4)
+	nb := newNetbox()
+	nb.Url = "https://example.org"
+	nb.Token = "s3kr3tt0ken"
+	nb.MaxTTL = time.Minute
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("my_host.", dns.TypeA)
+
+	_, err := nb.ServeDNS(context.Background(), rec, r)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	TTL := rec.Msg.Answer[0].Header().Ttl
+	if TTL != 60 {
+		t.Errorf("Expected TTL %v, got %v", 60, TTL)
+	}
+}
+
+func TestNetboxNativeSOA(t *testing.T) {
+	// the serial is the time of the last change in IPAM
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"ordering": "-last_updated", "limit": "1"}).Persist().Reply(
+		200).BodyString(`{"results": [{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.1/24", "dns_name": "my_host.example.org", "last_updated": "2025-03-24T23:13:07.123456Z"}]}`)
+
+	tests := []struct {
+		name  string
+		soa   SOAConfig
+		qname string
+		want  string
+	}{
+		{
+			"Default SOA",
+			SOAConfig{},
+			"example.org.",
+			"example.org.\t3600\tIN\tSOA\tns.dns.example.org. hostmaster.example.org. 1742857987 7200 1800 86400 30",
+		},
+		{
+			"Configured SOA",
+			SOAConfig{MName: "ns1.example.org.", RName: "admin.example.org.", Refresh: time.Hour, Retry: time.Minute, Expire: time.Hour * 48, Minimum: time.Minute * 5},
+			"example.org.",
+			"example.org.\t3600\tIN\tSOA\tns1.example.org. admin.example.org. 1742857987 3600 60 172800 300",
+		},
+		{
+			"SOA below zone apex",
+			SOAConfig{},
+			"my_host.example.org.",
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		nb := newNetbox()
+		nb.Url = "https://example.org"
+		nb.Token = "s3kr3tt0ken"
+		nb.Zones = []string{"example.org."}
+		nb.SOA = tt.soa
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion(tt.qname, dns.TypeSOA)
+
+		_, err := nb.ServeDNS(context.Background(), rec, r)
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.name, err)
+		}
+
+		if tt.want == "" {
+			if len(rec.Msg.Answer) != 0 {
+				t.Errorf("%s: expected no answer, got %v", tt.name, rec.Msg.Answer)
+			}
+			continue
+		}
+		if len(rec.Msg.Answer) != 1 {
+			t.Errorf("%s: expected one answer, got %v", tt.name, rec.Msg.Answer)
+			continue
+		}
+		if got := rec.Msg.Answer[0].String(); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestNetboxNegativeSOA(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"ordering": "-last_updated", "limit": "1"}).Persist().Reply(
+		200).BodyString(`{"results": [{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.1/24", "dns_name": "my_host.example.org", "last_updated": "2025-03-24T23:13:07.123456Z"}]}`)
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"dns_name": "missing.example.org"}).Reply(
+		200).BodyString(`{"results": []}`)
+
+	nb := newNetbox()
+	nb.Url = "https://example.org"
+	nb.Token = "s3kr3tt0ken"
+	nb.Zones = []string{"example.org."}
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("missing.example.org.", dns.TypeA)
+
+	_, err := nb.ServeDNS(context.Background(), rec, r)
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if rec.Rcode != dns.RcodeNameError {
+		t.Errorf("expected NXDOMAIN, got %s", dns.RcodeToString[rec.Rcode])
+	}
+	// the negative TTL is the SOA minimum
+	want := "example.org.\t30\tIN\tSOA\tns.dns.example.org. hostmaster.example.org. 1742857987 7200 1800 86400 30"
+	if len(rec.Msg.Ns) != 1 || rec.Msg.Ns[0].String() != want {
+		t.Errorf("expected authority %q, got %v", want, rec.Msg.Ns)
+	}
+}
+
+func TestNetboxNoData(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"ordering": "-last_updated", "limit": "1"}).Persist().Reply(
+		200).BodyString(`{"results": [{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.1/24", "dns_name": "my_host.example.org", "last_updated": "2025-03-24T23:13:07.123456Z"}]}`)
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"dns_name": "^v6only.example.org$"}).Persist().Reply(
+		200).BodyString(`{"results": [{"family": {"value": 6, "label": "IPv6"}, "address": "fd00::1/64", "dns_name": "v6only.example.org"}]}`)
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"dns_name": "^missing.example.org$"}).Persist().Reply(
+		200).BodyString(`{"results": []}`)
+
+	tests := []struct {
+		name  string
+		qname string
+		rcode int
+	}{
+		{"Name with IPv6 address only", "v6only.example.org.", dns.RcodeSuccess},
+		{"Missing name", "missing.example.org.", dns.RcodeNameError},
+	}
+
+	for _, tt := range tests {
+		nb := newNetbox()
+		nb.Url = "https://example.org"
+		nb.Token = "s3kr3tt0ken"
+		nb.Zones = []string{"example.org."}
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion(tt.qname, dns.TypeA)
+
+		_, err := nb.ServeDNS(context.Background(), rec, r)
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.name, err)
+		}
+		if rec.Rcode != tt.rcode {
+			t.Errorf("%s: expected %s, got %s", tt.name, dns.RcodeToString[tt.rcode], dns.RcodeToString[rec.Rcode])
+		}
+		if len(rec.Msg.Answer) != 0 {
+			t.Errorf("%s: expected no answer, got %v", tt.name, rec.Msg.Answer)
+		}
+		if len(rec.Msg.Ns) != 1 {
+			t.Errorf("%s: expected SOA in authority section, got %v", tt.name, rec.Msg.Ns)
+		}
+	}
+}
+
+func TestNetboxNativeAlias(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"dns_name": "^www.example.org$"}).Persist().Reply(
+		200).BodyString(`{"results": []}`)
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"cf_alias": "^www.example.org$"}).Persist().Reply(
+		200).BodyString(`{"results": [
+			{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.2/25", "dns_name": "web1.example.org", "custom_fields": {"alias": "www.example.org"}},
+			{"family": {"value": 6, "label": "IPv6"}, "address": "fd00::2/64", "dns_name": "web1.example.org", "custom_fields": {"alias": "www.example.org"}}
+		]}`)
+
+	tests := []struct {
+		name  string
+		qtype uint16
+		want  []string
+	}{
+		{"A of alias", dns.TypeA, []string{"www.example.org.\t3600\tIN\tCNAME\tweb1.example.org.", "web1.example.org.\t3600\tIN\tA\t10.0.0.2"}},
+		{"AAAA of alias", dns.TypeAAAA, []string{"www.example.org.\t3600\tIN\tCNAME\tweb1.example.org.", "web1.example.org.\t3600\tIN\tAAAA\tfd00::2"}},
+		{"CNAME of alias", dns.TypeCNAME, []string{"www.example.org.\t3600\tIN\tCNAME\tweb1.example.org."}},
+	}
+
+	for _, tt := range tests {
+		nb := newNetbox()
+		nb.Url = "https://example.org"
+		nb.Token = "s3kr3tt0ken"
+		nb.Zones = []string{"example.org."}
+		nb.AliasCustomField = "alias"
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion("www.example.org.", tt.qtype)
+
+		_, err := nb.ServeDNS(context.Background(), rec, r)
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.name, err)
+		}
+		var got []string
+		for _, rr := range rec.Msg.Answer {
+			got = append(got, rr.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestNetboxNativeTXT(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"dns_name": "^host1.example.org$"}).Persist().Reply(
+		200).BodyString(`{"results": [
+			{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.2/25", "dns_name": "host1.example.org", "custom_fields": {"txt": "v=spf1 -all"}},
+			{"family": {"value": 6, "label": "IPv6"}, "address": "fd00::2/64", "dns_name": "host1.example.org", "custom_fields": {"txt": "v=spf1 -all"}},
+			{"family": {"value": 6, "label": "IPv6"}, "address": "fd00::3/64", "dns_name": "host1.example.org", "custom_fields": {"txt": null}}
+		]}`)
+
+	tests := []struct {
+		name  string
+		field string
+		rcode int
+		want  []string
+	}{
+		{"TXT from custom field", "txt", dns.RcodeSuccess, []string{"host1.example.org.\t3600\tIN\tTXT\t\"v=spf1 -all\""}},
+		{"TXT without custom field", "", dns.RcodeServerFailure, nil},
+	}
+
+	for _, tt := range tests {
+		nb := newNetbox()
+		nb.Url = "https://example.org"
+		nb.Token = "s3kr3tt0ken"
+		nb.Zones = []string{"example.org."}
+		nb.TXTCustomField = tt.field
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion("host1.example.org.", dns.TypeTXT)
+
+		_, _ = nb.ServeDNS(context.Background(), rec, r)
+		if rec.Rcode != tt.rcode {
+			t.Errorf("%s: expected %s, got %s", tt.name, dns.RcodeToString[tt.rcode], dns.RcodeToString[rec.Rcode])
+		}
+		var got []string
+		for _, rr := range rec.Msg.Answer {
+			got = append(got, rr.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
@@ -14,9 +14,23 @@
 package netbox
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	golog "log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/test"
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
@@ -55,7 +69,7 @@ func TestQueryDNSPlugin(t *testing.T) {
 			}`,
 			false,
 			[]string{
-				"mail1.example.com.\t0\tIN\tA\t192.168.0.1",
+				"mail1.example.com.\t3600\tIN\tA\t192.168.0.1",
 			},
 		},
 		{
@@ -165,6 +179,12 @@ func TestQueryDNSPlugin(t *testing.T) {
 		},
 	}
 
+	defer gock.Off() // Flush pending mocks after test execution
+
+	// no wildcard records exist
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParam(
+		"fqdn", `^\*\.`).Persist().Reply(200).BodyString(`{"results": []}`)
+
 	// set up mock responses
 	for _, tt := range tests {
 		gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
@@ -177,11 +197,14 @@ func TestQueryDNSPlugin(t *testing.T) {
 			200).BodyString(tt.body)
 	}
 
+	// no other records exist
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").Persist().Reply(200).BodyString(`{"results": []}`)
+
 	// run tests
 	for _, tt := range tests {
 		r := new(dns.Msg)
 		r.SetQuestion(tt.fqdn, DNSRecordReverseMap[tt.dnsType])
-		responses, err := n.queryDNSPlugin(tt.zone, request.Request{Req: r})
+		responses, err := n.queryDNSPlugin(context.Background(), tt.zone, "", request.Request{Req: r})
 
 		if tt.wantErr {
 			assert.Error(t, err, tt.name)
@@ -196,6 +219,578 @@ func TestQueryDNSPlugin(t *testing.T) {
 	}
 }
 
+func TestQueryDNSPluginCNAMEChain(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	cname := func(fqdn, target string) string {
+		return `{"results": [{"type": "CNAME", "ttl": 8600, "value": "` + target + `", "absolute_value": "` + target + `", "fqdn": "` + fqdn + `"}]}`
+	}
+	mock := func(fqdn, body string) {
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+			map[string]string{
+				"zone":   "example.com",
+				"active": "true",
+				"fqdn":   fqdn,
+				"type":   "A",
+			}).Reply(200).BodyString(body)
+	}
+
+	tests := []struct {
+		name     string
+		maxDepth int
+		want     []string
+	}{
+		{
+			"Follow whole CNAME chain",
+			defaultMaxCNAMEDepth,
+			[]string{
+				"www.example.com.\t8600\tIN\tCNAME\talias.example.com.",
+				"alias.example.com.\t8600\tIN\tCNAME\tmail1.example.com.",
+				"mail1.example.com.\t8600\tIN\tA\t192.168.0.1",
+			},
+		},
+		{
+			"Truncate CNAME chain",
+			1,
+			[]string{
+				"www.example.com.\t8600\tIN\tCNAME\talias.example.com.",
+				"alias.example.com.\t8600\tIN\tCNAME\tmail1.example.com.",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		mock("www.example.com.", cname("www.example.com.", "alias.example.com."))
+		mock("alias.example.com.", cname("alias.example.com.", "mail1.example.com."))
+		if tt.maxDepth > 1 {
+			mock("mail1.example.com.", `{"results": [{"type": "A", "ttl": 8600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.com."}]}`)
+		}
+
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+		n.MaxCNAMEDepth = tt.maxDepth
+
+		r := new(dns.Msg)
+		r.SetQuestion("www.example.com.", dns.TypeA)
+		responses, err := n.queryDNSPlugin(context.Background(), "example.com.", "", request.Request{Req: r})
+		assert.NoError(t, err, tt.name)
+		if assert.Len(t, responses, len(tt.want), tt.name) {
+			for i, response := range responses {
+				assert.Equal(t, tt.want[i], response.String(), tt.name)
+			}
+		}
+		assert.True(t, gock.IsDone(), tt.name)
+	}
+}
+
+func TestQueryDNSPluginFlattenCNAME(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	mock := func(fqdn, body string) {
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+			map[string]string{
+				"zone":   "^example.com$",
+				"active": "^true$",
+				"fqdn":   "^" + regexp.QuoteMeta(fqdn) + "$",
+				"type":   "^A$",
+			}).Reply(200).BodyString(body)
+	}
+
+	tests := []struct {
+		name    string
+		flatten bool
+		want    []string
+	}{
+		{
+			"CNAME chain",
+			false,
+			[]string{
+				"www.example.com.\t3600\tIN\tCNAME\talias.example.com.",
+				"alias.example.com.\t300\tIN\tCNAME\tmail1.example.com.",
+				"mail1.example.com.\t8600\tIN\tA\t192.168.0.1",
+				"mail1.example.com.\t8600\tIN\tA\t192.168.0.2",
+			},
+		},
+		{
+			"flattened CNAME chain",
+			true,
+			[]string{
+				"www.example.com.\t300\tIN\tA\t192.168.0.1",
+				"www.example.com.\t300\tIN\tA\t192.168.0.2",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		mock("www.example.com.", `{"results": [{"type": "CNAME", "ttl": 3600, "value": "alias", "absolute_value": "alias.example.com.", "fqdn": "www.example.com."}]}`)
+		mock("alias.example.com.", `{"results": [{"type": "CNAME", "ttl": 300, "value": "mail1", "absolute_value": "mail1.example.com.", "fqdn": "alias.example.com."}]}`)
+		mock("mail1.example.com.", `{"results": [
+			{"type": "A", "ttl": 8600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.com."},
+			{"type": "A", "ttl": 8600, "value": "192.168.0.2", "absolute_value": "192.168.0.2", "fqdn": "mail1.example.com."}
+		]}`)
+
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+		n.FlattenCNAME = tt.flatten
+
+		r := new(dns.Msg)
+		r.SetQuestion("www.example.com.", dns.TypeA)
+		responses, err := n.queryDNSPlugin(context.Background(), "example.com.", "", request.Request{Req: r})
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, rrStrings(responses), tt.name)
+		assert.True(t, gock.IsDone(), tt.name)
+	}
+}
+
+func TestServeDNSGlue(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^example.org.$",
+			"type": "^MX$",
+		}).Reply(200).BodyString(`{"results": [
+			{"type": "MX", "ttl": 3600, "value": "10 mail1", "absolute_value": "10 mail1.example.org.", "fqdn": "example.org."},
+			{"type": "MX", "ttl": 3600, "value": "20 mx.example.net.", "absolute_value": "20 mx.example.net.", "fqdn": "example.org."}
+		]}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^mail1.example.org.$",
+		}).AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+		return slices.Equal(req.URL.Query()["type"], []string{"A", "AAAA"}), nil
+	}).Reply(200).BodyString(`{"results": [
+			{"type": "A", "ttl": 600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.org."},
+			{"type": "AAAA", "ttl": 600, "value": "fd00::1", "absolute_value": "fd00::1", "fqdn": "mail1.example.org."}
+		]}`)
+	// hosts outside of the zone are never looked up
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParam(
+		"fqdn", "example.net").Persist().Reply(200).BodyString(`{"results": []}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+	n.cache = newCache(defaultCacheSize)
+
+	// the second response is served from the cache including the glue
+	for i := 0; i < 2; i++ {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion("example.org.", dns.TypeMX)
+		_, err := n.ServeDNS(context.Background(), rec, r)
+		assert.NoError(t, err)
+		assert.Len(t, rec.Msg.Answer, 2)
+		assert.Equal(t, []string{
+			"mail1.example.org.\t600\tIN\tA\t192.168.0.1",
+			"mail1.example.org.\t600\tIN\tAAAA\tfd00::1",
+		}, rrStrings(rec.Msg.Extra))
+	}
+	assert.Len(t, gock.Pending(), 1)
+}
+
+func TestServeDNSMultipleMX(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^example.org.$",
+			"type": "^MX$",
+		}).Reply(200).BodyString(`{"results": [
+			{"type": "MX", "ttl": 3600, "value": "10 mx1.example.net.", "absolute_value": "10 mx1.example.net.", "fqdn": "example.org."},
+			{"type": "MX", "ttl": 3600, "value": "20 mx2.example.net.", "absolute_value": "20 mx2.example.net.", "fqdn": "example.org."},
+			{"type": "MX", "ttl": 3600, "value": "30 mx3.example.net.", "absolute_value": "30 mx3.example.net.", "fqdn": "example.org."}
+		]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("example.org.", dns.TypeMX)
+	_, err := n.ServeDNS(context.Background(), rec, r)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, rec.Rcode)
+	assert.Equal(t, []string{
+		"example.org.\t3600\tIN\tMX\t10 mx1.example.net.",
+		"example.org.\t3600\tIN\tMX\t20 mx2.example.net.",
+		"example.org.\t3600\tIN\tMX\t30 mx3.example.net.",
+	}, rrStrings(rec.Msg.Answer))
+	assert.True(t, gock.IsDone())
+}
+
+func TestServeDNSFallthroughOn(t *testing.T) {
+	tests := []struct {
+		mode      string
+		failed    bool
+		wantNext  bool
+		wantRcode int
+	}{
+		{"", true, true, dns.RcodeSuccess},
+		{"", false, true, dns.RcodeSuccess},
+		{FallthroughBoth, true, true, dns.RcodeSuccess},
+		{FallthroughBoth, false, true, dns.RcodeSuccess},
+		{FallthroughErrors, true, true, dns.RcodeSuccess},
+		{FallthroughErrors, false, false, dns.RcodeNameError},
+		{FallthroughEmpty, true, false, dns.RcodeServerFailure},
+		{FallthroughEmpty, false, true, dns.RcodeSuccess},
+	}
+
+	for _, tt := range tests {
+		name := fmt.Sprintf("%q failed=%t", tt.mode, tt.failed)
+		netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.failed {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte(`{"results": []}`))
+		}))
+
+		var next atomic.Int32
+		n := newNetbox()
+		n.Url = netbox.URL
+		n.Token = "mytoken"
+		n.Zones = []string{"example.org."}
+		n.Fall.SetZonesFromArgs(nil)
+		n.FallthroughOn = tt.mode
+		n.Next = test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+			next.Add(1)
+			return dns.RcodeSuccess, nil
+		})
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion("host1.example.org.", dns.TypeA)
+		_, err := n.ServeDNS(context.Background(), rec, r)
+		if tt.failed && !tt.wantNext {
+			assert.Error(t, err, name)
+		} else {
+			assert.NoError(t, err, name)
+		}
+		if tt.wantNext {
+			assert.Equal(t, int32(1), next.Load(), name)
+		} else {
+			assert.Equal(t, int32(0), next.Load(), name)
+			assert.Equal(t, tt.wantRcode, rec.Rcode, name)
+		}
+		netbox.Close()
+	}
+}
+
+func TestServeDNSRefuseOutsideZones(t *testing.T) {
+	tests := []struct {
+		name      string
+		refuse    bool
+		next      bool
+		wantRcode int
+		wantErr   bool
+	}{
+		{"refused without next plugin", true, false, dns.RcodeRefused, false},
+		{"passed on to next plugin", true, true, dns.RcodeSuccess, false},
+		{"failure without refuse_outside_zones", false, false, dns.RcodeServerFailure, true},
+	}
+
+	for _, tt := range tests {
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+		n.Zones = []string{"example.org."}
+		n.RefuseOutsideZones = tt.refuse
+		if tt.next {
+			n.Next = test.NextHandler(dns.RcodeSuccess, nil)
+		}
+
+		// NetBox is never asked for names outside of the zones
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion("host1.example.net.", dns.TypeA)
+		rcode, err := n.ServeDNS(context.Background(), rec, r)
+		if tt.wantErr {
+			assert.Error(t, err, tt.name)
+			assert.Equal(t, tt.wantRcode, rcode, tt.name)
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, dns.RcodeSuccess, rcode, tt.name)
+		if tt.next {
+			assert.Nil(t, rec.Msg, tt.name)
+		} else if assert.NotNil(t, rec.Msg, tt.name) {
+			assert.Equal(t, tt.wantRcode, rec.Rcode, tt.name)
+			assert.False(t, rec.Msg.Authoritative, tt.name)
+		}
+	}
+}
+
+func TestServeDNSOverlappingZones(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	// records are only mocked within the most specific zone
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^sub.example.org$",
+			"fqdn": "^host.sub.example.org.$",
+			"type": "^A$",
+		}).Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "host.sub.example.org."}]}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^www.example.org.$",
+			"type": "^A$",
+		}).Reply(200).BodyString(`{"results": [{"type": "CNAME", "ttl": 3600, "value": "web.sub", "absolute_value": "web.sub.example.org.", "fqdn": "www.example.org."}]}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^sub.example.org$",
+			"fqdn": "^web.sub.example.org.$",
+			"type": "^A$",
+		}).Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 600, "value": "192.168.0.2", "absolute_value": "192.168.0.2", "fqdn": "web.sub.example.org."}]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org.", "sub.example.org."}
+	n.UsePlugin = true
+
+	tests := []struct {
+		qname string
+		want  []string
+	}{
+		{"host.sub.example.org.", []string{"host.sub.example.org.\t600\tIN\tA\t192.168.0.1"}},
+		// the target of a CNAME is looked up in its own zone
+		{"www.example.org.", []string{
+			"www.example.org.\t3600\tIN\tCNAME\tweb.sub.example.org.",
+			"web.sub.example.org.\t600\tIN\tA\t192.168.0.2",
+		}},
+	}
+	for _, tt := range tests {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion(tt.qname, dns.TypeA)
+		_, err := n.ServeDNS(context.Background(), rec, r)
+		assert.NoError(t, err, tt.qname)
+		assert.Equal(t, tt.want, rrStrings(rec.Msg.Answer), tt.qname)
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestServeDNSApex(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^example.org.$",
+			"type": "^A$",
+		}).Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "example.org."}]}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^example.org.$",
+			"type": "^AAAA$",
+		}).Reply(200).BodyString(`{"results": [{"type": "AAAA", "ttl": 600, "value": "fd00::1", "absolute_value": "fd00::1", "fqdn": "example.org."}]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		want  []string
+	}{
+		{"example.org.", dns.TypeA, []string{"example.org.\t600\tIN\tA\t192.168.0.1"}},
+		{"Example.ORG.", dns.TypeAAAA, []string{"example.org.\t600\tIN\tAAAA\tfd00::1"}},
+	}
+	for _, tt := range tests {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion(tt.qname, tt.qtype)
+		_, err := n.ServeDNS(context.Background(), rec, r)
+		assert.NoError(t, err, tt.qname)
+		assert.Equal(t, dns.RcodeSuccess, rec.Msg.Rcode, tt.qname)
+		assert.Equal(t, tt.want, rrStrings(rec.Msg.Answer), tt.qname)
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestServeDNSRoundRobin(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^www.example.org.$",
+			"type": "^A$",
+		}).Reply(200).BodyString(`{"results": [{"type": "CNAME", "ttl": 3600, "value": "web", "absolute_value": "web.example.org.", "fqdn": "www.example.org."}]}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^web.example.org.$",
+			"type": "^A$",
+		}).Reply(200).BodyString(`{"results": [
+			{"type": "A", "ttl": 600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "web.example.org."},
+			{"type": "A", "ttl": 600, "value": "192.168.0.2", "absolute_value": "192.168.0.2", "fqdn": "web.example.org."},
+			{"type": "A", "ttl": 600, "value": "192.168.0.3", "absolute_value": "192.168.0.3", "fqdn": "web.example.org."}
+		]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+	n.RoundRobin = true
+	n.cache = newCache(defaultCacheSize)
+
+	// all responses but the first are served from the cache
+	first := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion("www.example.org.", dns.TypeA)
+		_, err := n.ServeDNS(context.Background(), rec, r)
+		assert.NoError(t, err)
+		assert.Len(t, rec.Msg.Answer, 4)
+		assert.Equal(t, dns.TypeCNAME, rec.Msg.Answer[0].Header().Rrtype)
+		first[rec.Msg.Answer[1].(*dns.A).A.String()] = true
+	}
+	assert.Len(t, first, 3)
+	assert.True(t, gock.IsDone())
+}
+
+func TestServeDNSNegativeSOA(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	zone := `{"results": [{
+		"name": "example.org",
+		"soa_mname": {"name": "ns1.example.org"},
+		"soa_rname": "hostmaster.example.org",
+		"soa_serial": 2025010101,
+		"soa_refresh": 3600,
+		"soa_retry": 600,
+		"soa_expire": 86400,
+		"soa_minimum": 300,
+		"soa_ttl": 3600
+	}]}`
+
+	tests := []struct {
+		name   string
+		status int
+		want   []string
+	}{
+		{
+			"SOA in authority section",
+			200,
+			[]string{"example.org.\t300\tIN\tSOA\tns1.example.org. hostmaster.example.org. 2025010101 3600 600 86400 300"},
+		},
+		{
+			"SOA not available",
+			500,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		// the name and the wildcard looked up instead do not exist
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+			map[string]string{
+				"zone": "^example.org$",
+				"fqdn": "example.org.$",
+			}).Persist().Reply(200).BodyString(`{"results": []}`)
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+			map[string]string{
+				"zone":      "^example.org$",
+				"fqdn__iew": "example.org.$",
+			}).Persist().Reply(200).BodyString(`{"results": []}`)
+		// the SOA is fetched once and kept in the cache
+		gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
+			map[string]string{
+				"name": "^example.org$",
+			}).Reply(tt.status).BodyString(zone)
+
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+		n.Zones = []string{"example.org."}
+		n.UsePlugin = true
+		n.cache = newCache(defaultCacheSize)
+
+		for i := 0; i < 2; i++ {
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			r := new(dns.Msg)
+			r.SetQuestion("missing.example.org.", dns.TypeA)
+			_, err := n.ServeDNS(context.Background(), rec, r)
+			assert.NoError(t, err, tt.name)
+			assert.Equal(t, dns.RcodeNameError, rec.Rcode, tt.name)
+			assert.Empty(t, rec.Msg.Answer, tt.name)
+			if tt.want == nil {
+				assert.Empty(t, rec.Msg.Ns, tt.name)
+				break
+			}
+			assert.Equal(t, tt.want, rrStrings(rec.Msg.Ns), tt.name)
+		}
+		gock.Off()
+	}
+}
+
+func TestServeDNSNoData(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	// mail1 only has an AAAA record, mail2 has no records at all
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^mail1.example.org.$",
+		}).AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+		return slices.Contains(req.URL.Query()["type"], "AAAA"), nil
+	}).Persist().Reply(200).BodyString(`{"results": [{"type": "AAAA", "ttl": 8600, "value": "fd00::1", "absolute_value": "fd00::1", "fqdn": "mail1.example.org."}]}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+		}).Persist().Reply(200).BodyString(`{"results": []}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
+		map[string]string{
+			"name": "^example.org$",
+		}).Persist().Reply(200).BodyString(`{"results": [{"name": "example.org", "soa_mname": {"name": "ns1.example.org"}, "soa_rname": "hostmaster.example.org", "soa_minimum": 300, "soa_ttl": 3600}]}`)
+
+	tests := []struct {
+		name  string
+		qname string
+		qtype uint16
+		rcode int
+	}{
+		{"Name without A record", "mail1.example.org.", dns.TypeA, dns.RcodeSuccess},
+		{"Name without MX record", "mail1.example.org.", dns.TypeMX, dns.RcodeSuccess},
+		{"Missing name", "mail2.example.org.", dns.TypeA, dns.RcodeNameError},
+		{"Zone apex without A record", "example.org.", dns.TypeA, dns.RcodeSuccess},
+	}
+
+	for _, tt := range tests {
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+		n.Zones = []string{"example.org."}
+		n.UsePlugin = true
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion(tt.qname, tt.qtype)
+		_, err := n.ServeDNS(context.Background(), rec, r)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.rcode, rec.Rcode, tt.name)
+		assert.Empty(t, rec.Msg.Answer, tt.name)
+		assert.Len(t, rec.Msg.Ns, 1, tt.name)
+	}
+}
+
 // {
 // 	"Query SOA Record",
 // 	"example.com.",
@@ -223,3 +818,750 @@ func TestQueryDNSPlugin(t *testing.T) {
 // 		"ns1.example.com. admin.example.com. 1742759410 43200 7200 2419200 3600",
 // 	},
 // },
+
+func TestQueryDNSPluginMinTTL(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.com",
+			"active": "true",
+			"fqdn":   "mail1.example.com.",
+			"type":   "A",
+		}).Reply(200).BodyString(`{
+			"results": [
+			{
+				"type": "A",
+				"ttl": null,
+				"value": "192.168.0.1",
+				"absolute_value": "192.168.0.1",
+				"fqdn": "mail1.example.com."
+			},
+			{
+				"type": "A",
+				"ttl": 5,
+				"value": "192.168.0.2",
+				"absolute_value": "192.168.0.2",
+				"fqdn": "mail1.example.com."
+			},
+			{
+				"type": "A",
+				"ttl": 8600,
+				"value": "192.168.0.3",
+				"absolute_value": "192.168.0.3",
+				"fqdn": "mail1.example.com."
+			}]
+		}`)
+	// the zone is asked for the SOA minimum of the record without TTL too
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").Persist().MatchParams(
+		map[string]string{
+			"name":   "example.com",
+			"active": "true",
+		}).Reply(200).BodyString(`{
+			"results": [
+			{
+				"name": "example.com",
+				"soa_ttl": 10,
+				"soa_mname": {
+					"name": "ns1.example.com"
+				},
+				"soa_rname": "admin.example.com",
+				"soa_serial": 1742857987,
+				"soa_refresh": 43200,
+				"soa_retry": 7200,
+				"soa_expire": 2419200,
+				"soa_minimum": 5
+			}]
+		}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.UsePlugin = true
+	n.MinTTL = time.Minute
+
+	r := new(dns.Msg)
+	r.SetQuestion("mail1.example.com.", dns.TypeA)
+	responses, err := n.queryDNSPlugin(context.Background(), "example.com.", "", request.Request{Req: r})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"mail1.example.com.\t60\tIN\tA\t192.168.0.1",
+		"mail1.example.com.\t60\tIN\tA\t192.168.0.2",
+		"mail1.example.com.\t8600\tIN\tA\t192.168.0.3",
+	}, rrStrings(responses))
+
+	// the TTL of the SOA is raised as well, its minimum is kept as configured
+	// in NetBox
+	r.SetQuestion("example.com.", dns.TypeSOA)
+	responses, err = n.queryDNSPlugin(context.Background(), "example.com.", "", request.Request{Req: r})
+	assert.NoError(t, err)
+	if assert.Len(t, responses, 1) {
+		soa := responses[0].(*dns.SOA)
+		assert.Equal(t, uint32(60), soa.Hdr.Ttl)
+		assert.Equal(t, uint32(5), soa.Minttl)
+	}
+}
+
+func TestQueryDNSPluginMaxTTL(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.com",
+			"active": "true",
+			"fqdn":   "mail1.example.com.",
+			"type":   "A",
+		}).Reply(200).BodyString(`{
+			"results": [
+			{
+				"type": "A",
+				"ttl": 86400,
+				"value": "192.168.0.1",
+				"absolute_value": "192.168.0.1",
+				"fqdn": "mail1.example.com."
+			},
+			{
+				"type": "A",
+				"ttl": 30,
+				"value": "192.168.0.2",
+				"absolute_value": "192.168.0.2",
+				"fqdn": "mail1.example.com."
+			}]
+		}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.MaxTTL = time.Minute * 5
+
+	r := new(dns.Msg)
+	r.SetQuestion("mail1.example.com.", dns.TypeA)
+	responses, err := n.queryDNSPlugin(context.Background(), "example.com.", "", request.Request{Req: r})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"mail1.example.com.\t300\tIN\tA\t192.168.0.1",
+		"mail1.example.com.\t30\tIN\tA\t192.168.0.2",
+	}, rrStrings(responses))
+
+	// the TTL of the SOA is capped as well
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
+		map[string]string{
+			"name":   "example.com",
+			"active": "true",
+		}).Reply(200).BodyString(`{
+			"results": [
+			{
+				"name": "example.com",
+				"soa_ttl": 86400,
+				"soa_mname": {
+					"name": "ns1.example.com"
+				},
+				"soa_rname": "admin.example.com",
+				"soa_serial": 1742857987,
+				"soa_refresh": 43200,
+				"soa_retry": 7200,
+				"soa_expire": 2419200,
+				"soa_minimum": 3600
+			}]
+		}`)
+	r.SetQuestion("example.com.", dns.TypeSOA)
+	responses, err = n.queryDNSPlugin(context.Background(), "example.com.", "", request.Request{Req: r})
+	assert.NoError(t, err)
+	if assert.Len(t, responses, 1) {
+		soa := responses[0].(*dns.SOA)
+		assert.Equal(t, uint32(300), soa.Hdr.Ttl)
+		assert.Equal(t, uint32(3600), soa.Minttl)
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestQueryDNSPluginANY(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	// the whole supported query set is requested at once
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.com",
+			"active": "true",
+			"fqdn":   "mail1.example.com.",
+		}).AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+		return assert.ObjectsAreEqual(req.URL.Query()["type"], strings.Split(strings.ReplaceAll(string(DNSQuerySetANY), "type=", ""), "&")), nil
+	}).Reply(200).BodyString(`{
+			"results": [
+			{
+				"type": "A",
+				"ttl": 8600,
+				"value": "192.168.0.1",
+				"absolute_value": "192.168.0.1",
+				"fqdn": "mail1.example.com."
+			},
+			{
+				"type": "TXT",
+				"ttl": 8600,
+				"value": "\"v=spf1 -all\"",
+				"absolute_value": "\"v=spf1 -all\"",
+				"fqdn": "mail1.example.com."
+			}]
+		}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+
+	r := new(dns.Msg)
+	r.SetQuestion("mail1.example.com.", dns.TypeANY)
+	responses, err := n.queryDNSPlugin(context.Background(), "example.com.", "", request.Request{Req: r})
+	assert.NoError(t, err)
+	if assert.Len(t, responses, 2) {
+		assert.Equal(t, dns.TypeA, responses[0].Header().Rrtype)
+		assert.Equal(t, dns.TypeTXT, responses[1].Header().Rrtype)
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestServeDNSTruncated(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	var records []string
+	for i := 1; i <= 100; i++ {
+		records = append(records, fmt.Sprintf(`{"type": "A", "ttl": 300, "value": "10.0.0.%[1]d", "absolute_value": "10.0.0.%[1]d", "fqdn": "many.example.org."}`, i))
+	}
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").Persist().Reply(200).BodyString(`{"results": [` + strings.Join(records, ",") + `]}`)
+
+	tests := []struct {
+		name      string
+		tcp       bool
+		size      uint16
+		truncated bool
+	}{
+		{"UDP without EDNS0", false, 0, true},
+		{"UDP with small buffer", false, 1232, true},
+		{"UDP with large buffer", false, 4096, false},
+		{"TCP", true, 0, false},
+	}
+
+	for _, tt := range tests {
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+		n.Zones = []string{"example.org."}
+		n.UsePlugin = true
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{TCP: tt.tcp})
+		r := new(dns.Msg)
+		r.SetQuestion("many.example.org.", dns.TypeA)
+		if tt.size > 0 {
+			r.SetEdns0(tt.size, false)
+		}
+		_, err := n.ServeDNS(context.Background(), rec, r)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.truncated, rec.Msg.Truncated, tt.name)
+		if tt.truncated {
+			assert.Less(t, len(rec.Msg.Answer), 100, tt.name)
+		} else {
+			assert.Len(t, rec.Msg.Answer, 100, tt.name)
+		}
+
+		size := max(int(tt.size), dns.MinMsgSize)
+		if tt.tcp {
+			size = dns.MaxMsgSize
+		}
+		assert.LessOrEqual(t, rec.Msg.Len(), size, tt.name)
+	}
+}
+
+func TestQueryDNSPluginConcurrentCNAMEs(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	mock := func(fqdn, body string) *gock.Response {
+		return gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+			map[string]string{
+				"fqdn": "^" + regexp.QuoteMeta(fqdn) + "$",
+				"type": "^A$",
+			}).Reply(200).BodyString(body)
+	}
+	mock("www.example.org.", `{"results": [
+		{"type": "CNAME", "ttl": 300, "value": "web1", "absolute_value": "web1.example.org.", "fqdn": "www.example.org."},
+		{"type": "CNAME", "ttl": 300, "value": "web2", "absolute_value": "web2.example.org.", "fqdn": "www.example.org."},
+		{"type": "CNAME", "ttl": 300, "value": "web3", "absolute_value": "web3.example.org.", "fqdn": "www.example.org."}
+	]}`)
+	// the first target answers last, its records are still placed first
+	mock("web1.example.org.", `{"results": [{"type": "A", "ttl": 300, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "web1.example.org."}]}`).Delay(100 * time.Millisecond)
+	mock("web2.example.org.", `{"results": [{"type": "A", "ttl": 300, "value": "192.168.0.2", "absolute_value": "192.168.0.2", "fqdn": "web2.example.org."}]}`)
+	mock("web3.example.org.", `{"results": [{"type": "CNAME", "ttl": 300, "value": "web4", "absolute_value": "web4.example.org.", "fqdn": "web3.example.org."}]}`)
+	mock("web4.example.org.", `{"results": [{"type": "A", "ttl": 300, "value": "192.168.0.4", "absolute_value": "192.168.0.4", "fqdn": "web4.example.org."}]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+
+	r := new(dns.Msg)
+	r.SetQuestion("www.example.org.", dns.TypeA)
+	answers, err := n.queryDNSPlugin(context.Background(), "example.org.", "", request.Request{Req: r})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"www.example.org.\t300\tIN\tCNAME\tweb1.example.org.",
+		"www.example.org.\t300\tIN\tCNAME\tweb2.example.org.",
+		"www.example.org.\t300\tIN\tCNAME\tweb3.example.org.",
+		"web1.example.org.\t300\tIN\tA\t192.168.0.1",
+		"web2.example.org.\t300\tIN\tA\t192.168.0.2",
+		"web3.example.org.\t300\tIN\tCNAME\tweb4.example.org.",
+		"web4.example.org.\t300\tIN\tA\t192.168.0.4",
+	}, rrStrings(answers))
+	assert.True(t, gock.IsDone())
+}
+
+func TestLookupRecords(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	mock := func(fqdn, body string) {
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+			map[string]string{
+				"zone": "^example.org$",
+				"fqdn": "^" + regexp.QuoteMeta(fqdn) + "$",
+				"type": "^A$",
+			}).Reply(200).BodyString(body)
+	}
+	mock("www.example.org.", `{"results": [{"type": "CNAME", "ttl": 300, "value": "web1", "absolute_value": "web1.example.org.", "fqdn": "www.example.org."}]}`)
+	mock("web1.example.org.", `{"results": [{"type": "A", "ttl": 300, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "web1.example.org."}]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+
+	// names are canonicalized and the zone is taken from the configuration
+	records, err := n.LookupRecords(context.Background(), "", "WWW.Example.org", dns.TypeA)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"www.example.org.\t300\tIN\tCNAME\tweb1.example.org.",
+		"web1.example.org.\t300\tIN\tA\t192.168.0.1",
+	}, rrStrings(records))
+	assert.True(t, gock.IsDone())
+
+	_, err = n.LookupRecords(context.Background(), "example.org", "www.example.net.", dns.TypeA)
+	assert.Error(t, err)
+	_, err = n.LookupRecords(context.Background(), "", "www.example.net.", dns.TypeA)
+	assert.Error(t, err)
+}
+
+func TestServeDNSUpstreamBudget(t *testing.T) {
+	// every host is a CNAME to the next one, a chain without end
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var i int
+		fqdn := r.URL.Query().Get("fqdn")
+		if _, err := fmt.Sscanf(fqdn, "host%d.example.org.", &i); err != nil {
+			_, _ = w.Write([]byte(`{"results": []}`))
+			return
+		}
+		fmt.Fprintf(w, `{"results": [{"type": "CNAME", "ttl": 300, "value": "host%[1]d", "absolute_value": "host%[1]d.example.org.", "fqdn": "%[2]s"}]}`, i+1, fqdn)
+	}))
+	defer server.Close()
+
+	n := newNetbox()
+	n.Url = server.URL
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+	n.MaxCNAMEDepth = 100
+	n.MaxUpstreamCalls = 5
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("host0.example.org.", dns.TypeA)
+	_, err := n.ServeDNS(context.Background(), rec, r)
+	assert.NoError(t, err)
+
+	// the question and four CNAME targets are looked up, then the chain is cut
+	assert.Equal(t, int32(5), calls.Load())
+	assert.Len(t, rec.Msg.Answer, 5)
+}
+
+func TestQueryDNSPluginOffType(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	// NetBox answers the A query with a stray PTR record
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"fqdn": "^mail1.example.com.$",
+			"type": "^A$",
+		}).Reply(200).BodyString(`{"results": [
+			{"type": "A", "ttl": 8600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.com."},
+			{"type": "PTR", "ttl": 8600, "value": "mail1.example.com.", "absolute_value": "mail1.example.com.", "fqdn": "mail1.example.com."}
+		]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+
+	r := new(dns.Msg)
+	r.SetQuestion("mail1.example.com.", dns.TypeA)
+	answers, err := n.queryDNSPlugin(context.Background(), "example.com.", "", request.Request{Req: r})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mail1.example.com.\t8600\tIN\tA\t192.168.0.1"}, rrStrings(answers))
+	assert.True(t, gock.IsDone())
+}
+
+func TestQueryDNSPluginApexNS(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	tests := []struct {
+		name    string
+		records string
+		zones   string
+	}{
+		{
+			"NS records",
+			`{"results": [
+				{"type": "NS", "ttl": 86400, "value": "ns1.example.org.", "absolute_value": "ns1.example.org.", "fqdn": "example.org."},
+				{"type": "NS", "ttl": 86400, "value": "ns2.example.org", "absolute_value": "ns2.example.org", "fqdn": "example.org."}
+			]}`,
+			"",
+		},
+		{
+			"name servers of the zone",
+			`{"results": []}`,
+			`{"results": [{"name": "example.org", "soa_mname": {"name": "ns1.example.org"}, "soa_rname": "hostmaster.example.org", "soa_ttl": 86400, "nameservers": [{"name": "ns1.example.org"}, {"name": "ns2.example.org."}]}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+			map[string]string{
+				"fqdn": "^example.org.$",
+				"type": "^NS$",
+			}).Reply(200).BodyString(tt.records)
+		if tt.zones != "" {
+			gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParam(
+				"name", "^example.org$").Reply(200).BodyString(tt.zones)
+		}
+
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+
+		r := new(dns.Msg)
+		r.SetQuestion("example.org.", dns.TypeNS)
+		answers, err := n.queryDNSPlugin(context.Background(), "example.org.", "", request.Request{Req: r})
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, []string{
+			"example.org.\t86400\tIN\tNS\tns1.example.org.",
+			"example.org.\t86400\tIN\tNS\tns2.example.org.",
+		}, rrStrings(answers), tt.name)
+		assert.True(t, gock.IsDone(), tt.name)
+		gock.Off()
+	}
+}
+
+func TestServeDNSDNSSEC(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"fqdn": "^mail1.example.org.$",
+			"type": "^A$",
+		}).Persist().Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 3600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.org."}]}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"fqdn": "^mail1.example.org.$",
+			"type": "^RRSIG$",
+		}).Reply(200).BodyString(`{"results": [
+			{"type": "RRSIG", "ttl": 3600, "value": "A 13 3 3600 20270101000000 20260101000000 12345 example.org. dGVzdA==", "absolute_value": "A 13 3 3600 20270101000000 20260101000000 12345 example.org. dGVzdA==", "fqdn": "mail1.example.org."},
+			{"type": "RRSIG", "ttl": 3600, "value": "AAAA 13 3 3600 20270101000000 20260101000000 12345 example.org. dGVzdA==", "absolute_value": "AAAA 13 3 3600 20270101000000 20260101000000 12345 example.org. dGVzdA==", "fqdn": "mail1.example.org."}
+		]}`)
+
+	tests := []struct {
+		name   string
+		dnssec bool
+		do     bool
+		want   []string
+	}{
+		{"DO bit without dnssec", false, true, []string{"mail1.example.org.\t3600\tIN\tA\t192.168.0.1"}},
+		{"dnssec without DO bit", true, false, []string{"mail1.example.org.\t3600\tIN\tA\t192.168.0.1"}},
+		{
+			"dnssec with DO bit",
+			true,
+			true,
+			[]string{
+				"mail1.example.org.\t3600\tIN\tA\t192.168.0.1",
+				"mail1.example.org.\t3600\tIN\tRRSIG\tA 13 3 3600 20270101000000 20260101000000 12345 example.org. dGVzdA==",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+		n.Zones = []string{"example.org."}
+		n.UsePlugin = true
+		n.DNSSEC = tt.dnssec
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion("mail1.example.org.", dns.TypeA)
+		r.SetEdns0(4096, tt.do)
+		_, err := n.ServeDNS(context.Background(), rec, r)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, rrStrings(rec.Msg.Answer), tt.name)
+		if opt := rec.Msg.IsEdns0(); assert.NotNil(t, opt, tt.name) {
+			assert.Equal(t, tt.do, opt.Do(), tt.name)
+		}
+	}
+	// only the persisted mock of the A record is left
+	assert.Len(t, gock.Pending(), 1)
+}
+
+func TestQueryDNSPluginNullTTL(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"fqdn": "^mail1.example.com.$",
+		}).Reply(200).BodyString(`{"results": [{"type": "A", "ttl": null, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.com."}]}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
+		map[string]string{
+			"name": "^example.com$",
+		}).Reply(200).BodyString(`{"results": [{"name": "example.com", "soa_mname": {"name": "ns1.example.com"}, "soa_rname": "hostmaster.example.com", "soa_minimum": 3600, "soa_ttl": 86400}]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.com."}
+	n.UsePlugin = true
+	n.TTL = time.Minute
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("mail1.example.com.", dns.TypeA)
+	_, err := n.ServeDNS(context.Background(), rec, r)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mail1.example.com.\t3600\tIN\tA\t192.168.0.1"}, rrStrings(rec.Msg.Answer))
+	assert.True(t, gock.IsDone())
+}
+
+func TestQueryDNSPluginCustomFieldTTL(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"fqdn": "^mail1.example.com.$",
+		}).Reply(200).BodyString(`{"results": [
+			{"type": "A", "ttl": 8600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.com.", "custom_fields": {"override_ttl": 60, "owner": "ops"}},
+			{"type": "A", "ttl": 8600, "value": "192.168.0.2", "absolute_value": "192.168.0.2", "fqdn": "mail1.example.com.", "custom_fields": {"override_ttl": null}},
+			{"type": "A", "ttl": 8600, "value": "192.168.0.3", "absolute_value": "192.168.0.3", "fqdn": "mail1.example.com.", "custom_fields": {"override_ttl": "soon"}},
+			{"type": "A", "ttl": 8600, "value": "192.168.0.4", "absolute_value": "192.168.0.4", "fqdn": "mail1.example.com."}
+		]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.com."}
+	n.UsePlugin = true
+	n.TTLCustomField = "override_ttl"
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("mail1.example.com.", dns.TypeA)
+	_, err := n.ServeDNS(context.Background(), rec, r)
+	assert.NoError(t, err)
+
+	// only the record with the custom field set is served with its TTL
+	assert.Equal(t, []string{
+		"mail1.example.com.\t60\tIN\tA\t192.168.0.1",
+		"mail1.example.com.\t8600\tIN\tA\t192.168.0.2",
+		"mail1.example.com.\t8600\tIN\tA\t192.168.0.3",
+		"mail1.example.com.\t8600\tIN\tA\t192.168.0.4",
+	}, rrStrings(rec.Msg.Answer))
+	assert.True(t, gock.IsDone())
+}
+
+// zoneServer returns a NetBox DNS plugin serving the records of a zone given
+// as "fqdn type value", filtered by fqdn or the suffix of fqdn and by type
+func zoneServer(records ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var results []string
+		for _, record := range records {
+			fields := strings.SplitN(record, " ", 3)
+			switch {
+			case query.Has("fqdn") && query.Get("fqdn") != fields[0]:
+				continue
+			case query.Has("fqdn__iew") && !strings.HasSuffix(fields[0], query.Get("fqdn__iew")):
+				continue
+			case query.Has("type") && !slices.Contains(query["type"], fields[1]):
+				continue
+			}
+			results = append(results, fmt.Sprintf(`{"type": %q, "ttl": 8600, "value": %[2]q, "absolute_value": %[2]q, "fqdn": %[3]q}`, fields[1], fields[2], fields[0]))
+		}
+		fmt.Fprintf(w, `{"results": [%s]}`, strings.Join(results, ","))
+	}))
+}
+
+func TestQueryDNSPluginWildcard(t *testing.T) {
+	tests := []struct {
+		name    string
+		qname   string
+		qtype   uint16
+		records []string
+		want    []string
+	}{
+		{
+			"Wildcard hit",
+			"a.b.example.com.",
+			dns.TypeA,
+			[]string{"*.example.com. A 192.168.0.1"},
+			[]string{"a.b.example.com.\t8600\tIN\tA\t192.168.0.1"},
+		},
+		{
+			"CNAME at wildcard",
+			"www.example.com.",
+			dns.TypeA,
+			[]string{"*.example.com. CNAME mail1.example.com.", "mail1.example.com. A 192.168.0.1"},
+			[]string{
+				"www.example.com.\t8600\tIN\tCNAME\tmail1.example.com.",
+				"mail1.example.com.\t8600\tIN\tA\t192.168.0.1",
+			},
+		},
+		{
+			"No wildcard",
+			"a.b.example.com.",
+			dns.TypeA,
+			nil,
+			[]string{},
+		},
+		{
+			"Name with records of other types",
+			"www.example.com.",
+			dns.TypeAAAA,
+			[]string{"www.example.com. A 192.168.0.2", "*.example.com. AAAA 2001:db8::1"},
+			[]string{},
+		},
+		{
+			"Closest encloser with records",
+			"a.b.example.com.",
+			dns.TypeA,
+			[]string{"b.example.com. TXT text", "*.example.com. A 192.168.0.1"},
+			[]string{},
+		},
+		{
+			"Empty non-terminal",
+			"b.example.com.",
+			dns.TypeA,
+			[]string{"a.b.example.com. TXT text", "*.example.com. A 192.168.0.1"},
+			[]string{},
+		},
+		{
+			"Wildcard of the closest encloser",
+			"a.b.example.com.",
+			dns.TypeA,
+			[]string{"c.b.example.com. TXT text", "*.b.example.com. A 192.168.0.2", "*.example.com. A 192.168.0.1"},
+			[]string{"a.b.example.com.\t8600\tIN\tA\t192.168.0.2"},
+		},
+	}
+
+	for _, tt := range tests {
+		netbox := zoneServer(tt.records...)
+
+		n := newNetbox()
+		n.Url = netbox.URL
+		n.Token = "mytoken"
+
+		r := new(dns.Msg)
+		r.SetQuestion(tt.qname, tt.qtype)
+		responses, err := n.queryDNSPlugin(context.Background(), "example.com.", "", request.Request{Req: r})
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, rrStrings(responses), tt.name)
+		netbox.Close()
+	}
+}
+
+func TestQueryDNSPluginMixedCase(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	mock := func(fqdn, body string) {
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+			map[string]string{
+				"zone":   "^example.com$",
+				"active": "^true$",
+				"fqdn":   "^" + regexp.QuoteMeta(fqdn) + "$",
+				"type":   "^A$",
+			}).Reply(200).BodyString(body)
+	}
+	mock("www.example.com.", `{"results": [{"type": "CNAME", "ttl": 8600, "value": "Mail1.Example.com.", "absolute_value": "Mail1.Example.com.", "fqdn": "WWW.example.com."}]}`)
+	mock("mail1.example.com.", `{"results": [{"type": "A", "ttl": 8600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "Mail1.example.com."}]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.com."}
+	n.UsePlugin = true
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("Www.EXAMPLE.com.", dns.TypeA)
+	_, err := n.ServeDNS(context.Background(), rec, r)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"www.example.com.\t8600\tIN\tCNAME\tMail1.Example.com.",
+		"mail1.example.com.\t8600\tIN\tA\t192.168.0.1",
+	}, rrStrings(rec.Msg.Answer))
+	assert.True(t, gock.IsDone())
+}
+
+func TestLogQueries(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	// capture the debug log
+	var buf bytes.Buffer
+	golog.SetOutput(&buf)
+	defer golog.SetOutput(os.Stderr)
+	clog.D.Set()
+	defer clog.D.Clear()
+
+	for _, enabled := range []bool{true, false} {
+		buf.Reset()
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 8600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.org."}]}`)
+
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+		n.Zones = []string{"example.org."}
+		n.UsePlugin = true
+		n.LogQueries = enabled
+
+		r := new(dns.Msg)
+		r.SetQuestion("mail1.example.org.", dns.TypeA)
+		_, err := n.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), r)
+		assert.NoError(t, err)
+
+		out := buf.String()
+		if !enabled {
+			assert.Empty(t, out)
+			continue
+		}
+		assert.Contains(t, out, "[DEBUG] plugin/netbox: GET https://example.org/api/plugins/netbox-dns/records/?")
+		assert.Contains(t, out, " returned 200 in ")
+		assert.Contains(t, out, "lookup of mail1.example.org. A in zone example.org. returned 1 records in ")
+		assert.NotContains(t, out, "mytoken")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	n := newNetbox()
+	assert.Equal(t, "https://example.org/?token=", n.redact("https://example.org/?token="))
+
+	n.Token = "mytoken"
+	assert.Equal(t, "https://example.org/?token=REDACTED", n.redact("https://example.org/?token=mytoken"))
+}
+
+func rrStrings(rrs []dns.RR) []string {
+	s := make([]string, len(rrs))
+	for i, rr := range rrs {
+		s[i] = rr.String()
+	}
+	return s
+}
@@ -15,19 +15,49 @@
 package netbox
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/miekg/dns"
 )
 
 type Record struct {
 	Family   Family `json:"family"`
 	Address  string `json:"address"`
 	HostName string `json:"dns_name,omitempty"`
+	// CustomFields holds the values of the NetBox custom fields of the address
+	CustomFields map[string]json.RawMessage `json:"custom_fields,omitempty"`
+	// LastUpdated is when the address was changed last
+	LastUpdated time.Time `json:"last_updated"`
+}
+
+// customText returns the text set in the custom field name of the address, it
+// is empty if the field is missing, null or not a text
+func (r *Record) customText(name string) string {
+	value, ok := r.CustomFields[name]
+	if !ok {
+		return ""
+	}
+	var text *string
+	if err := json.Unmarshal(value, &text); err != nil || text == nil {
+		return ""
+	}
+	return *text
 }
 
 type Family struct {
@@ -39,53 +69,392 @@ type RecordsList struct {
 	Records []Record `json:"results"`
 }
 
-func get(client *http.Client, url, token string) (*http.Response, error) {
+// apiURL joins the NetBox URL, the API prefix and path, normalizing the
+// slashes between them
+func (n *Netbox) apiURL(path string) string {
+	return strings.TrimRight(n.Url, "/") + n.APIPrefix + "/" + strings.TrimLeft(path, "/")
+}
+
+// maxRateLimitWait is how long a request may wait for the rate limit before
+// it fails
+const maxRateLimitWait = time.Millisecond * 250 // 250ms
+
+// maxRetryAfter is how long a request rejected with 429 Too Many Requests
+// waits for its single retry at most
+const maxRetryAfter = time.Second * 1 // 1s
+
+// errTooManyRequests is returned if NetBox keeps rejecting a request with 429
+// Too Many Requests
+var errTooManyRequests = errors.New("NetBox rejected the request with too many requests")
+
+// errRateLimited is returned if a request is not sent to NetBox as it exceeds
+// the configured rate limit
+var errRateLimited = errors.New("rate limit of requests against NetBox exceeded")
+
+// errNotFound is returned if NetBox does not know the requested endpoint, e.g.
+// as the NetBox DNS plugin is not installed
+var errNotFound = errors.New("not found")
+
+// errBudgetExhausted is returned if a query already caused as many requests
+// against NetBox as MaxUpstreamCalls allows
+var errBudgetExhausted = errors.New("budget of requests against NetBox exhausted")
+
+// budgetKey is the context key of the budget of requests of a query
+type budgetKey struct{}
+
+// withBudget returns ctx carrying a budget of calls requests against NetBox
+func withBudget(ctx context.Context, calls int) context.Context {
+	if calls <= 0 {
+		return ctx
+	}
+	budget := new(atomic.Int64)
+	budget.Store(int64(calls))
+	return context.WithValue(ctx, budgetKey{}, budget)
+}
+
+// spend takes a request from the budget carried by ctx and reports whether it
+// was available. Requests without a budget, like the status checks and the
+// pages of a shared request, are not bounded.
+func spend(ctx context.Context) bool {
+	budget, ok := ctx.Value(budgetKey{}).(*atomic.Int64)
+	return !ok || budget.Add(-1) >= 0
+}
+
+// get performs a GET request against NetBox with the additional header, the
+// round-trip time is observed under endpoint
+func (n *Netbox) get(ctx context.Context, endpoint, url string, header http.Header) (*http.Response, error) {
 	// handle if provided client was not set up
+	client := n.Client
 	if client == nil {
 		return nil, fmt.Errorf("provided *http.Client was invalid")
 	}
 
+	// bound the requests a single query fans out into
+	if !spend(ctx) {
+		return nil, errBudgetExhausted
+	}
+
+	// wait for the rate limit shortly, but fail rather than queue up requests
+	if n.limiter != nil {
+		waitCtx, cancel := context.WithTimeout(ctx, maxRateLimitWait)
+		queuedRequests.Inc()
+		err := n.limiter.Wait(waitCtx)
+		queuedRequests.Dec()
+		cancel()
+		if err != nil {
+			requestErrors.WithLabelValues(errorRateLimited).Inc()
+			return nil, errRateLimited
+		}
+	}
+
 	// set up HTTP request
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	// set additional headers, the authorization header below always wins
+	for _, h := range []http.Header{n.Headers, header} {
+		for key, values := range h {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+	}
+
+	// identify the plugin towards NetBox
+	userAgent := n.UserAgent
+	if userAgent == "" {
+		userAgent = "coredns-netbox-plugin/" + VERSION
+	}
+	req.Header.Set("User-Agent", userAgent)
+
 	// set authorization header for request to NetBox
-	req.Header.Set("Authorization", fmt.Sprintf("Token %s", token))
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", n.Token))
+
+	// the transport only decompresses responses transparently if it asked for
+	// gzip itself, as the header is set here it is done below
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	inflightRequests.Inc()
+	defer inflightRequests.Dec()
+
+	// do request, it is retried once if NetBox asks to come back shortly or
+	// the attempt runs out of the query timeout
+	var resp *http.Response
+	for retried := false; ; retried = true {
+		// the deadline of the attempt is released once its body is closed
+		attempt, cancel := ctx, context.CancelFunc(func() {})
+		if n.QueryTimeout > 0 {
+			attempt, cancel = context.WithTimeout(ctx, n.QueryTimeout)
+		}
 
-	// do request
-	return client.Do(req)
+		start := time.Now()
+		resp, err = client.Do(req.WithContext(attempt))
+		requestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+		if n.LogQueries {
+			n.logRequest(req, resp, err, time.Since(start))
+		}
+		if err != nil {
+			cancel()
+			requestErrors.WithLabelValues(errorReason(err)).Inc()
+			traceResponse(ctx, 0, err)
+			if !retried && attempt.Err() != nil && ctx.Err() == nil {
+				continue
+			}
+			return nil, err
+		}
+		traceResponse(ctx, resp.StatusCode, nil)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			break
+		}
+
+		resp.Body.Close()
+		cancel()
+		wait, ok := retryAfter(resp.Header.Get("Retry-After"))
+		if retried || !ok || wait > maxRetryAfter {
+			requestErrors.WithLabelValues(errorTooManyRequests).Inc()
+			return nil, errTooManyRequests
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			requestErrors.WithLabelValues(errorReason(ctx.Err())).Inc()
+			return nil, ctx.Err()
+		}
+	}
+
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			requestErrors.WithLabelValues(errorDecode).Inc()
+			return nil, fmt.Errorf("could not decompress response: %w", err)
+		}
+		resp.Body = &gzipBody{Reader: zr, body: resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return resp, nil
 }
 
-func (n *Netbox) query(host string, family int) ([]net.IP, error) {
-	var (
-		dns_name = strings.TrimSuffix(host, ".")
-		requrl   = fmt.Sprintf("%s/api/ipam/ip-addresses/?dns_name=%s", n.Url, dns_name)
-		records  RecordsList
-	)
+// logRequest logs a request against NetBox at debug level with the token
+// removed from its URL
+func (n *Netbox) logRequest(req *http.Request, resp *http.Response, err error, latency time.Duration) {
+	requrl := n.redact(req.URL.Redacted())
+	if err != nil {
+		log.Debugf("GET %s failed after %s: %s", requrl, latency, n.redact(err.Error()))
+		return
+	}
+	log.Debugf("GET %s returned %d in %s", requrl, resp.StatusCode, latency)
+}
 
-	// Initialise an empty slice of IP addresses
-	addresses := make([]net.IP, 0)
+// redact replaces the token in s
+func (n *Netbox) redact(s string) string {
+	if n.Token == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, n.Token, "REDACTED")
+}
 
-	// do http request against NetBox instance
-	resp, err := get(n.Client, requrl, n.Token)
+// retryAfter parses the Retry-After header given in seconds or as HTTP date,
+// dates in the past are returned as zero
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
 	if err != nil {
-		return addresses, fmt.Errorf("problem performing request: %w", err)
+		return 0, false
+	}
+	return max(time.Until(date), 0), true
+}
+
+// gzipBody decompresses a gzip encoded response body
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+// Close closes the decompressor and the underlying body
+func (b *gzipBody) Close() error {
+	err := b.Reader.Close()
+	if cerr := b.body.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// cancelBody releases the deadline of a request once its body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the deadline
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// errorReason classifies an error returned by the HTTP client
+func errorReason(err error) string {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return errorTimeout
+	}
+	return errorConnection
+}
+
+// maxPooledBuffer is the capacity up to which buffers of response bodies are
+// returned to bufferPool, larger ones are left to the garbage collector
+const maxPooledBuffer = 4 << 20 // 4MiB
+
+// bufferPool holds the buffers response bodies are read into for decoding
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// maxETags limits the responses kept to revalidate them with If-None-Match
+const maxETags = 1000
+
+// etagEntry holds a response body NetBox tagged with an ETag
+type etagEntry struct {
+	etag string
+	body []byte
+}
+
+// etag returns the response body stored for requrl
+func (n *Netbox) etag(requrl string) (etagEntry, bool) {
+	n.etagMu.Lock()
+	defer n.etagMu.Unlock()
+	entry, ok := n.etags[requrl]
+	return entry, ok
+}
+
+// setETag stores the response body for requrl tagged with etag, an arbitrary
+// entry is dropped once maxETags are stored
+func (n *Netbox) setETag(requrl, etag string, body []byte) {
+	n.etagMu.Lock()
+	defer n.etagMu.Unlock()
+	if n.etags == nil {
+		n.etags = make(map[string]etagEntry)
+	}
+	if _, ok := n.etags[requrl]; !ok && len(n.etags) >= maxETags {
+		for key := range n.etags {
+			delete(n.etags, key)
+			break
+		}
+	}
+	n.etags[requrl] = etagEntry{etag: etag, body: body}
+}
+
+// getJSON performs a GET request against NetBox and decodes the JSON response
+// into v. Responses tagged with an ETag are revalidated with If-None-Match,
+// the stored body is decoded again if NetBox answers 304 Not Modified.
+func (n *Netbox) getJSON(ctx context.Context, endpoint, requrl string, v interface{}) error {
+	var header http.Header
+	stored, revalidate := n.etag(requrl)
+	if revalidate {
+		header = http.Header{"If-None-Match": {stored.etag}}
 	}
 
+	// do http request against NetBox instance
+	resp, err := n.get(ctx, endpoint, requrl, header)
+	if err != nil {
+		return fmt.Errorf("problem performing request: %w", err)
+	}
 	// ensure body is closed once we are done
 	defer resp.Body.Close()
 
-	// status code must be http.StatusOK
-	if resp.StatusCode != http.StatusOK {
-		return addresses, fmt.Errorf("bad HTTP response code: %d", resp.StatusCode)
+	// read the body into a pooled buffer, it is reset before reuse
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	var body []byte
+	switch {
+	case revalidate && resp.StatusCode == http.StatusNotModified:
+		body = stored.body
+	case resp.StatusCode == http.StatusOK:
+		if _, err := buf.ReadFrom(resp.Body); err != nil {
+			requestErrors.WithLabelValues(errorDecode).Inc()
+			return fmt.Errorf("could not read response: %w", err)
+		}
+		body = buf.Bytes()
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			// the stored body must outlive the pooled buffer
+			n.setETag(requrl, etag, bytes.Clone(body))
+		}
+	default:
+		// status code must be http.StatusOK
+		requestErrors.WithLabelValues(errorBadStatus).Inc()
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("bad HTTP response code: %d: %w", resp.StatusCode, errNotFound)
+		}
+		return fmt.Errorf("bad HTTP response code: %d", resp.StatusCode)
+	}
+
+	// parse response body, json.Unmarshal does not keep a reference to it
+	if err := json.Unmarshal(body, v); err != nil {
+		requestErrors.WithLabelValues(errorDecode).Inc()
+		return fmt.Errorf("could not unmarshal response: %w", err)
+	}
+
+	return nil
+}
+
+// queryURL returns the URL of the API endpoint at path with the encoded
+// params, restricted to the objects of the configured tenant.
+func (n *Netbox) queryURL(path string, params url.Values) string {
+	if n.Tenant != "" {
+		params.Set("tenant", n.Tenant)
 	}
+	return n.apiURL(path) + "?" + params.Encode()
+}
 
-	// read and parse response body
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&records); err != nil {
-		return addresses, fmt.Errorf("could not unmarshal response: %w", err)
+// addressesURL returns the URL of the IP addresses of IPAM matching params,
+// restricted to the configured VRF given by its ID or route distinguisher.
+func (n *Netbox) addressesURL(params url.Values) string {
+	if n.VRF != "" {
+		if _, err := strconv.Atoi(n.VRF); err == nil {
+			params.Set("vrf_id", n.VRF)
+		} else {
+			params.Set("vrf", n.VRF)
+		}
+	}
+	return n.queryURL("ipam/ip-addresses/", params)
+}
+
+func (n *Netbox) query(ctx context.Context, host string, family int) ([]net.IP, error) {
+	var (
+		dns_name = strings.TrimSuffix(host, ".")
+		requrl   = n.addressesURL(url.Values{"dns_name": {dns_name}})
+		records  RecordsList
+	)
+
+	// Initialise an empty slice of IP addresses
+	addresses := make([]net.IP, 0)
+
+	// do http request against NetBox instance
+	if err := n.getJSON(ctx, endpointIPAddresses, requrl, &records); err != nil {
+		return addresses, err
 	}
 
 	// handle empty list of records
@@ -105,45 +474,168 @@ func (n *Netbox) query(host string, family int) ([]net.IP, error) {
 	return addresses, nil
 }
 
-func (n *Netbox) queryreverse(host string) ([]string, error) {
+// queryserial returns when an IP address of IPAM was changed last as serial
+// of the SOA, which is 0 without any addresses
+func (n *Netbox) queryserial(ctx context.Context) (uint32, error) {
+	var records RecordsList
+	requrl := n.addressesURL(url.Values{"ordering": {"-last_updated"}, "limit": {"1"}})
+	if err := n.getJSON(ctx, endpointIPAddresses, requrl, &records); err != nil {
+		return 0, err
+	}
+	if len(records.Records) == 0 {
+		return 0, nil
+	}
+	return uint32(records.Records[0].LastUpdated.Unix()), nil
+}
+
+// queryalias returns the name and the addresses of family of the IP addresses
+// whose custom field AliasCustomField holds host. The addresses of the first
+// name found are returned only, a family of 0 returns none.
+func (n *Netbox) queryalias(ctx context.Context, host string, family int) (string, []net.IP, error) {
 	var (
-		ip      = dnsutil.ExtractAddressFromReverse(host)
-		requrl  = fmt.Sprintf("%s/api/ipam/ip-addresses/?address=%s", n.Url, ip)
+		alias   = strings.TrimSuffix(host, ".")
+		requrl  = n.addressesURL(url.Values{"cf_" + n.AliasCustomField: {alias}})
 		records RecordsList
 	)
 
-	// // Initialise an empty slice of domains
-	domains := make([]string, 0)
+	if err := n.getJSON(ctx, endpointIPAddresses, requrl, &records); err != nil {
+		return "", nil, err
+	}
 
-	// do http request against NetBox instance
-	resp, err := get(n.Client, requrl, n.Token)
-	if err != nil {
-		return domains, fmt.Errorf("problem performing request: %w", err)
+	// a name can only be an alias of a single name
+	target := ""
+	addresses := make([]net.IP, 0)
+	for _, r := range records.Records {
+		if r.HostName == "" {
+			continue
+		}
+		name := dns.CanonicalName(r.HostName)
+		if target == "" {
+			target = name
+		}
+		if name != target || r.Family.Version != family {
+			continue
+		}
+		if addr := net.ParseIP(strings.Split(r.Address, "/")[0]); addr != nil {
+			addresses = append(addresses, addr)
+		}
 	}
+	return target, addresses, nil
+}
 
-	// ensure body is closed once we are done
-	defer resp.Body.Close()
+// querytxt returns the texts of the custom field TXTCustomField of the IP
+// addresses with the dns_name host
+func (n *Netbox) querytxt(ctx context.Context, host string) ([]string, error) {
+	var (
+		dns_name = strings.TrimSuffix(host, ".")
+		requrl   = n.addressesURL(url.Values{"dns_name": {dns_name}})
+		records  RecordsList
+	)
+
+	texts := make([]string, 0)
+	if err := n.getJSON(ctx, endpointIPAddresses, requrl, &records); err != nil {
+		return texts, err
+	}
+	for _, r := range records.Records {
+		if text := r.customText(n.TXTCustomField); text != "" && !slices.Contains(texts, text) {
+			texts = append(texts, text)
+		}
+	}
+	return texts, nil
+}
 
-	// status code must be http.StatusOK
-	if resp.StatusCode != http.StatusOK {
-		return domains, fmt.Errorf("bad HTTP response code: %d", resp.StatusCode)
+// reverseAddress returns the address of a complete in-addr.arpa or ip6.arpa
+// name. IPv6 addresses are rebuilt from all 32 nibble labels, partial names
+// return nil.
+func reverseAddress(name string) net.IP {
+	name = strings.ToLower(dns.Fqdn(name))
+	if !strings.HasSuffix(name, dnsutil.IP6arpa) {
+		return net.ParseIP(dnsutil.ExtractAddressFromReverse(name)).To4()
 	}
 
-	// read and parse response body
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&records); err != nil {
-		return domains, fmt.Errorf("could not unmarshal response: %w", err)
+	nibbles := strings.Split(strings.TrimSuffix(name, dnsutil.IP6arpa), ".")
+	if len(nibbles) != 2*net.IPv6len {
+		return nil
 	}
+	ip := make(net.IP, net.IPv6len)
+	for i, nibble := range nibbles {
+		v, err := strconv.ParseUint(nibble, 16, 4)
+		if err != nil || len(nibble) != 1 {
+			return nil
+		}
+		// labels start with the least significant nibble
+		pos := len(nibbles) - 1 - i
+		ip[pos/2] |= byte(v) << (4 * (1 - pos%2))
+	}
+	return ip
+}
 
-	// handle empty list of records
-	if len(records.Records) == 0 {
+func (n *Netbox) queryreverse(ctx context.Context, host string) ([]string, error) {
+	var records RecordsList
+
+	// // Initialise an empty slice of domains
+	domains := make([]string, 0)
+
+	// a partial reverse name does not point to any address, querying NetBox
+	// without an address would return all of them
+	ip := reverseAddress(host)
+	if ip == nil {
 		return domains, nil
 	}
+	requrl := n.addressesURL(url.Values{"address": {ip.String()}})
+
+	// do http request against NetBox instance
+	if err := n.getJSON(ctx, endpointIPAddresses, requrl, &records); err != nil {
+		return domains, err
+	}
 
-	// grab returned domains
+	// grab returned domains, addresses without a dns_name have none
 	for _, r := range records.Records {
+		if r.HostName == "" {
+			continue
+		}
 		domains = append(domains, strings.TrimSuffix(r.HostName, ".")+".")
 	}
 
+	// synthesize the PTR from the forward records of the address instead
+	if len(domains) == 0 && n.SynthesizePTR {
+		return n.queryforward(ctx, host, ip)
+	}
+
+	return domains, nil
+}
+
+// queryforward returns the names of the active A or AAAA records of
+// netbox-dns pointing to ip, apart from those with disable_ptr set. Inactive
+// records are included if IncludeInactive is set. No names are found if the
+// NetBox DNS plugin is not installed.
+func (n *Netbox) queryforward(ctx context.Context, host string, ip net.IP) ([]string, error) {
+	rrtype := "A"
+	if ip.To4() == nil {
+		rrtype = "AAAA"
+	}
+	params := url.Values{"type": {rrtype}, "value": {ip.String()}}
+	if !n.IncludeInactive {
+		params.Set("active", "true")
+	}
+
+	domains := make([]string, 0)
+	records, err := n.queryRecords(ctx, host, n.pluginURL("records/", params))
+	if errors.Is(err, errNotFound) {
+		log.Debugf("can not synthesize PTR for %s without the NetBox DNS plugin", ip)
+		return domains, nil
+	}
+	if err != nil {
+		return domains, err
+	}
+	for _, r := range records {
+		// no PTR is served for records which opt out of it
+		if r.DisablePTR {
+			continue
+		}
+		if name := dns.CanonicalName(r.FQDN); !slices.Contains(domains, name) {
+			domains = append(domains, name)
+		}
+	}
 	return domains, nil
 }
@@ -16,11 +16,20 @@
 package netbox
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
 	"gopkg.in/h2non/gock.v1"
 )
 
@@ -118,7 +127,7 @@ func TestQuery(t *testing.T) {
 
 	// run tests
 	for _, tt := range tests {
-		got, err := n.query(tt.host, tt.family)
+		got, err := n.query(context.Background(), tt.host, tt.family)
 		if tt.wantErr {
 			assert.Error(t, err, tt.name)
 		} else {
@@ -128,6 +137,317 @@ func TestQuery(t *testing.T) {
 	}
 }
 
+func TestAPIURL(t *testing.T) {
+	tests := []struct {
+		url    string
+		prefix string
+		path   string
+		want   string
+	}{
+		{"https://example.org", "/api", "status", "https://example.org/api/status"},
+		{"https://example.org/", "/api", "/status", "https://example.org/api/status"},
+		{"https://example.org/netbox", "/api", "plugins/netbox-dns/records/", "https://example.org/netbox/api/plugins/netbox-dns/records/"},
+		{"https://example.org/netbox//", "/v1/api", "//ipam/ip-addresses/", "https://example.org/netbox/v1/api/ipam/ip-addresses/"},
+		{"https://example.org", "", "status", "https://example.org/status"},
+	}
+
+	for _, tt := range tests {
+		n := newNetbox()
+		n.Url = tt.url
+		n.APIPrefix = tt.prefix
+		assert.Equal(t, tt.want, n.apiURL(tt.path), tt.want)
+	}
+}
+
+func TestQueryHeaders(t *testing.T) {
+	// set up dummy Netbox
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Headers = http.Header{
+		"X-Scope-Orgid": {"tenant1"},
+		"Authorization": {"Token other"},
+	}
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"dns_name": "host1"}).MatchHeaders(
+		map[string]string{
+			"X-Scope-OrgID": "^tenant1$",
+			"Authorization": "^Token mytoken$",
+		}).Reply(200).BodyString(`{"results": []}`)
+
+	_, err := n.query(context.Background(), "host1", familyIP4)
+	assert.NoError(t, err)
+	assert.True(t, gock.IsDone())
+}
+
+func TestQueryCanceled(t *testing.T) {
+	// set up dummy Netbox
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"dns_name": "^host1$"}).Reply(200).Delay(
+		time.Second * 5).BodyString(`{"results": []}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*50, cancel)
+
+	start := time.Now()
+	_, err := n.query(ctx, "host1", familyIP4)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	// the first attempts hang, the others are answered right away
+	var attempts, hang atomic.Int32
+	hang.Store(1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if hang.Add(-1) >= 0 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte(`{"results": [{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.2/25", "dns_name": "host1"}]}`))
+	}))
+	defer ts.Close()
+
+	n := newNetbox()
+	n.Url = ts.URL
+	n.Token = "mytoken"
+	n.QueryTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	addresses, err := n.query(context.Background(), "host1", familyIP4)
+	assert.NoError(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("10.0.0.2")}, addresses)
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.Less(t, time.Since(start), time.Second)
+
+	// an attempt running out of time again is not retried any further
+	attempts.Store(0)
+	hang.Store(2)
+	_, err = n.query(context.Background(), "host1", familyIP4)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestQueryRateLimit(t *testing.T) {
+	var calls atomic.Int32
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte(`{"results": []}`))
+	}))
+	defer netbox.Close()
+
+	// set up dummy Netbox allowing 10 requests per second
+	n := newNetbox()
+	n.Url = netbox.URL
+	n.Token = "mytoken"
+	n.limiter = rate.NewLimiter(10, 10)
+
+	const requests = 50
+	var (
+		wg      sync.WaitGroup
+		limited atomic.Int32
+	)
+	start := time.Now()
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := n.query(context.Background(), "host1", familyIP4); errors.Is(err, errRateLimited) {
+				limited.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the burst and the requests allowed while waiting reach NetBox, all
+	// others fail instead of queuing up
+	allowed := 10 + int32(time.Since(start).Seconds()*10) + 1
+	assert.LessOrEqual(t, calls.Load(), allowed)
+	assert.Equal(t, int32(requests), calls.Load()+limited.Load())
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestQueryETag(t *testing.T) {
+	var calls atomic.Int32
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first response is tagged, later ones are revalidated
+		if calls.Add(1) > 1 {
+			assert.Equal(t, `"v1"`, r.Header.Get("If-None-Match"))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"results": [{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.1/24", "dns_name": "host1"}]}`))
+	}))
+	defer netbox.Close()
+
+	// set up dummy Netbox
+	n := newNetbox()
+	n.Url = netbox.URL
+	n.Token = "mytoken"
+
+	for i := 0; i < 2; i++ {
+		ips, err := n.query(context.Background(), "host1", familyIP4)
+		assert.NoError(t, err)
+		assert.Equal(t, []net.IP{net.ParseIP("10.0.0.1")}, ips)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestQueryTooManyRequests(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	tests := []struct {
+		name       string
+		retryAfter []string
+		wantErr    error
+	}{
+		{"retried after 429", []string{"0"}, nil},
+		{"retried after 429 with date", []string{time.Now().UTC().Format(http.TimeFormat)}, nil},
+		{"429 twice", []string{"0", "0"}, errTooManyRequests},
+		{"Retry-After beyond budget", []string{"120"}, errTooManyRequests},
+		{"429 without Retry-After", []string{""}, errTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		for _, value := range tt.retryAfter {
+			gock.New("https://example.org/api/ipam/ip-addresses/").Reply(429).SetHeader("Retry-After", value)
+		}
+		if tt.wantErr == nil {
+			gock.New("https://example.org/api/ipam/ip-addresses/").Reply(200).
+				BodyString(`{"results": [{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.2/25", "dns_name": "host1"}]}`)
+		}
+
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+
+		got, err := n.query(context.Background(), "host1", familyIP4)
+		if tt.wantErr != nil {
+			assert.ErrorIs(t, err, tt.wantErr, tt.name)
+		} else if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, []net.IP{net.ParseIP("10.0.0.2")}, got, tt.name)
+		}
+		assert.True(t, gock.IsDone(), tt.name)
+		gock.Off()
+	}
+}
+
+func TestQueryTenant(t *testing.T) {
+	// set up dummy Netbox
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Tenant = "acme"
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	// only the address of the tenant is returned when filtering
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"dns_name": "^host1$", "tenant": "^acme$"}).Reply(
+		200).BodyString(`{"results": [{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.1/25", "dns_name": "host1"}]}`)
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"dns_name": "^host1$"}).Reply(
+		200).BodyString(`{"results": [{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.1/25", "dns_name": "host1"}, {"family": {"value": 4, "label": "IPv4"}, "address": "10.1.0.1/25", "dns_name": "host1"}]}`)
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+		map[string]string{"address": "^10.1.0.1$", "tenant": "^acme$"}).Reply(
+		200).BodyString(`{"results": []}`)
+
+	addresses, err := n.query(context.Background(), "host1", familyIP4)
+	assert.NoError(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("10.0.0.1")}, addresses)
+
+	domains, err := n.queryreverse(context.Background(), "1.0.1.10.in-addr.arpa.")
+	assert.NoError(t, err)
+	assert.Empty(t, domains)
+
+	// the unfiltered mock must not have been used
+	assert.Len(t, gock.Pending(), 1)
+}
+
+func TestQueryVRF(t *testing.T) {
+	tests := []struct {
+		name  string
+		vrf   string
+		param string
+	}{
+		{"VRF by ID", "2", "vrf_id"},
+		{"VRF by route distinguisher", "65000:100", "vrf"},
+	}
+
+	for _, tt := range tests {
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+		n.VRF = tt.vrf
+
+		// the address is used in two VRFs, only the one of the filtered VRF
+		// is returned
+		gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+			map[string]string{"dns_name": "^host1$", tt.param: "^" + regexp.QuoteMeta(tt.vrf) + "$"}).Reply(
+			200).BodyString(`{"results": [{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.2/25", "dns_name": "host1"}]}`)
+		gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+			map[string]string{"address": "^10.0.0.2$", tt.param: "^" + regexp.QuoteMeta(tt.vrf) + "$"}).Reply(
+			200).BodyString(`{"results": [{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.2/25", "dns_name": "host1.vrf2"}]}`)
+		gock.New("https://example.org/api/ipam/ip-addresses/").Reply(
+			200).BodyString(`{"results": [{"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.1/25", "dns_name": "host1"}, {"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.2/25", "dns_name": "host1"}]}`)
+
+		addresses, err := n.query(context.Background(), "host1", familyIP4)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, []net.IP{net.ParseIP("10.0.0.2")}, addresses, tt.name)
+
+		domains, err := n.queryreverse(context.Background(), "2.0.0.10.in-addr.arpa.")
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, []string{"host1.vrf2."}, domains, tt.name)
+
+		// the unfiltered mock must not have been used
+		assert.Len(t, gock.Pending(), 1, tt.name)
+		gock.Off()
+	}
+}
+
+func TestQueryUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{"default", "", "^coredns-netbox-plugin/" + regexp.QuoteMeta(VERSION) + "$"},
+		{"configured", "dns-resolver/1.0", "^dns-resolver/1\\.0$"},
+	}
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	for _, tt := range tests {
+		// set up dummy Netbox
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+		n.UserAgent = tt.userAgent
+
+		gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
+			map[string]string{"dns_name": "host1"}).MatchHeader(
+			"User-Agent", tt.want).Reply(200).BodyString(`{"results": []}`)
+
+		_, err := n.query(context.Background(), "host1", familyIP4)
+		assert.NoError(t, err, tt.name)
+		assert.True(t, gock.IsDone(), tt.name)
+	}
+}
+
 func TestReverseQuery(t *testing.T) {
 	// set up dummy Netbox
 	n := newNetbox()
@@ -137,6 +457,7 @@ func TestReverseQuery(t *testing.T) {
 	tests := []struct {
 		name    string
 		reverse string
+		address string
 		body    string
 		wantErr bool
 		want    []string
@@ -144,6 +465,7 @@ func TestReverseQuery(t *testing.T) {
 		{
 			"Reverse Query",
 			"2.0.0.10.in-addr.arpa.",
+			"10.0.0.2",
 			`{
 				"results": [
 					{"address": "10.0.0.2", "dns_name": "domain.com"}
@@ -154,6 +476,20 @@ func TestReverseQuery(t *testing.T) {
 				"domain.com.",
 			},
 		},
+		{
+			"Reverse IPv6 Query",
+			"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+			"2001:db8::1",
+			`{
+				"results": [
+					{"address": "2001:db8::1/64", "dns_name": "v6.domain.com"}
+				]
+			}`,
+			false,
+			[]string{
+				"v6.domain.com.",
+			},
+		},
 	}
 
 	defer gock.Off() // Flush pending mocks after test execution
@@ -161,13 +497,13 @@ func TestReverseQuery(t *testing.T) {
 	// set up mock responses
 	for _, tt := range tests {
 		gock.New("https://example.org/api/ipam/ip-addresses/").MatchParams(
-			map[string]string{"address": "10.0.0.2"}).Reply(
+			map[string]string{"address": tt.address}).Reply(
 			200).BodyString(tt.body)
 	}
 
 	// run tests
 	for _, tt := range tests {
-		got, err := n.queryreverse(tt.reverse)
+		got, err := n.queryreverse(context.Background(), tt.reverse)
 		if tt.wantErr {
 			assert.Error(t, err, tt.name)
 		} else {
@@ -176,4 +512,179 @@ func TestReverseQuery(t *testing.T) {
 			assert.Equal(t, tt.want, got, tt.reverse)
 		}
 	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestReverseQuerySynthesizePTR(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	tests := []struct {
+		name       string
+		synthesize bool
+		rrtype     string
+		reverse    string
+		address    string
+		want       []string
+	}{
+		{"without synthesize_ptr", false, "", "3.0.0.10.in-addr.arpa.", "10.0.0.3", []string{}},
+		{"IPv4 address", true, "A", "3.0.0.10.in-addr.arpa.", "10.0.0.3", []string{"host3.example.org."}},
+		{
+			"IPv6 address",
+			true,
+			"AAAA",
+			"3.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+			"2001:db8::3",
+			[]string{"host3.example.org."},
+		},
+	}
+
+	for _, tt := range tests {
+		// the address is known to IPAM but has no dns_name
+		gock.New("https://example.org/api/ipam/ip-addresses/").MatchParam("address", "^"+regexp.QuoteMeta(tt.address)+"$").
+			Reply(200).BodyString(fmt.Sprintf(`{"results": [{"address": "%s/24", "dns_name": ""}]}`, tt.address))
+		if tt.synthesize {
+			gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+				map[string]string{
+					"type":   "^" + tt.rrtype + "$",
+					"value":  "^" + regexp.QuoteMeta(tt.address) + "$",
+					"active": "^true$",
+				}).Reply(200).BodyString(fmt.Sprintf(`{"results": [
+					{"type": "%[1]s", "ttl": 600, "value": "%[2]s", "absolute_value": "%[2]s", "fqdn": "host3.example.org."},
+					{"type": "%[1]s", "ttl": 600, "value": "%[2]s", "absolute_value": "%[2]s", "fqdn": "Host3.example.org."}
+				]}`, tt.rrtype, tt.address))
+		}
+
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "mytoken"
+		n.SynthesizePTR = tt.synthesize
+
+		got, err := n.queryreverse(context.Background(), tt.reverse)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+		assert.True(t, gock.IsDone(), tt.name)
+	}
+}
+
+func TestReverseQuerySynthesizePTRDisabled(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParam("address", "^10\\.0\\.0\\.3$").
+		Reply(200).BodyString(`{"results": [{"address": "10.0.0.3/24", "dns_name": ""}]}`)
+	// netbox-dns flags the A records, the PTR records of host4 were never
+	// created because of it
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"type":   "^A$",
+			"value":  "^10\\.0\\.0\\.3$",
+			"active": "^true$",
+		}).Reply(200).BodyString(`{"results": [
+			{
+				"id": 7,
+				"url": "https://example.org/api/plugins/netbox-dns/records/7/",
+				"zone": {"id": 1, "url": "https://example.org/api/plugins/netbox-dns/zones/1/", "display": "example.org", "name": "example.org", "view": {"id": 1, "name": "_default_"}, "status": "active", "active": true, "rfc2317_prefix": null},
+				"display": "host3.example.org [A]",
+				"type": "A",
+				"name": "host3",
+				"fqdn": "host3.example.org.",
+				"value": "10.0.0.3",
+				"status": "active",
+				"ttl": null,
+				"managed": false,
+				"disable_ptr": false,
+				"ptr_record": null,
+				"active": true
+			},
+			{
+				"id": 8,
+				"url": "https://example.org/api/plugins/netbox-dns/records/8/",
+				"zone": {"id": 1, "url": "https://example.org/api/plugins/netbox-dns/zones/1/", "display": "example.org", "name": "example.org", "view": {"id": 1, "name": "_default_"}, "status": "active", "active": true, "rfc2317_prefix": null},
+				"display": "host4.example.org [A]",
+				"type": "A",
+				"name": "host4",
+				"fqdn": "host4.example.org.",
+				"value": "10.0.0.3",
+				"status": "active",
+				"ttl": null,
+				"managed": false,
+				"disable_ptr": true,
+				"ptr_record": null,
+				"active": true
+			}
+		]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.SynthesizePTR = true
+
+	got, err := n.queryreverse(context.Background(), "3.0.0.10.in-addr.arpa.")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"host3.example.org."}, got)
+	assert.True(t, gock.IsDone())
+}
+
+func TestReverseQuerySynthesizePTRWithoutPlugin(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	// the address has no dns_name and the NetBox DNS plugin is not installed
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParam("address", "^10\\.0\\.0\\.3$").
+		Reply(200).BodyString(`{"results": [{"address": "10.0.0.3/24", "dns_name": ""}]}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").Reply(404).BodyString(`{"detail": "Not found."}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.SynthesizePTR = true
+
+	got, err := n.queryreverse(context.Background(), "3.0.0.10.in-addr.arpa.")
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+	assert.True(t, gock.IsDone())
+}
+
+func TestReverseQuerySynthesizePTRInactive(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/ipam/ip-addresses/").MatchParam("address", "^10\\.0\\.0\\.3$").
+		Reply(200).BodyString(`{"results": [{"address": "10.0.0.3/24", "dns_name": ""}]}`)
+	// inactive records are asked for as well
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"type":  "^A$",
+			"value": "^10\\.0\\.0\\.3$",
+		}).AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+		return !req.URL.Query().Has("active"), nil
+	}).Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 600, "value": "10.0.0.3", "absolute_value": "10.0.0.3", "fqdn": "host3.example.org."}]}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.SynthesizePTR = true
+	n.IncludeInactive = true
+
+	got, err := n.queryreverse(context.Background(), "3.0.0.10.in-addr.arpa.")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"host3.example.org."}, got)
+	assert.True(t, gock.IsDone())
+}
+
+func TestReverseAddress(t *testing.T) {
+	tests := []struct {
+		reverse string
+		want    net.IP
+	}{
+		{"2.0.0.10.in-addr.arpa.", net.ParseIP("10.0.0.2").To4()},
+		{"0.0.10.in-addr.arpa.", nil},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", net.ParseIP("2001:db8::1")},
+		{"F.E.D.C.B.A.9.8.7.6.5.4.3.2.1.0.F.E.D.C.B.A.9.8.7.6.5.4.3.2.1.0.IP6.ARPA.", net.ParseIP("0123:4567:89ab:cdef:0123:4567:89ab:cdef")},
+		{"8.b.d.0.1.0.0.2.ip6.arpa.", nil},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.g.ip6.arpa.", nil},
+		{"10.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", nil},
+		{"example.org.", nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, reverseAddress(tt.reverse), tt.reverse)
+	}
 }
@@ -14,38 +14,80 @@
 package netbox
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net"
-	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/miekg/dns"
+	ot "github.com/opentracing/opentracing-go"
 )
 
 type DNSRecordType string
 
 const (
-	DNSRecordTypeA     DNSRecordType = "A"
-	DNSRecordTypeAAAA  DNSRecordType = "AAAA"
-	DNSRecordTypePTR   DNSRecordType = "PTR"
-	DNSRecordTypeCNAME DNSRecordType = "CNAME"
-	DNSRecordTypeNS    DNSRecordType = "NS"
-	DNSRecordTypeSOA   DNSRecordType = "SOA"
-	DNSRecordTypeMX    DNSRecordType = "MX"
-	DNSRecordTypeTXT   DNSRecordType = "TXT"
+	DNSRecordTypeA          DNSRecordType = "A"
+	DNSRecordTypeAAAA       DNSRecordType = "AAAA"
+	DNSRecordTypePTR        DNSRecordType = "PTR"
+	DNSRecordTypeCNAME      DNSRecordType = "CNAME"
+	DNSRecordTypeNS         DNSRecordType = "NS"
+	DNSRecordTypeSOA        DNSRecordType = "SOA"
+	DNSRecordTypeMX         DNSRecordType = "MX"
+	DNSRecordTypeTXT        DNSRecordType = "TXT"
+	DNSRecordTypeSRV        DNSRecordType = "SRV"
+	DNSRecordTypeCAA        DNSRecordType = "CAA"
+	DNSRecordTypeTLSA       DNSRecordType = "TLSA"
+	DNSRecordTypeSSHFP      DNSRecordType = "SSHFP"
+	DNSRecordTypeNAPTR      DNSRecordType = "NAPTR"
+	DNSRecordTypeOPENPGPKEY DNSRecordType = "OPENPGPKEY"
+	DNSRecordTypeSMIMEA     DNSRecordType = "SMIMEA"
+	DNSRecordTypeCERT       DNSRecordType = "CERT"
+	DNSRecordTypeKX         DNSRecordType = "KX"
+	DNSRecordTypeRP         DNSRecordType = "RP"
+	DNSRecordTypeDNSKEY     DNSRecordType = "DNSKEY"
+	DNSRecordTypeDS         DNSRecordType = "DS"
+	DNSRecordTypeRRSIG      DNSRecordType = "RRSIG"
+	DNSRecordTypeNSEC       DNSRecordType = "NSEC"
+	DNSRecordTypeAFSDB      DNSRecordType = "AFSDB"
+	DNSRecordTypeSVCB       DNSRecordType = "SVCB"
+	DNSRecordTypeHTTPS      DNSRecordType = "HTTPS"
+	DNSRecordTypeZONEMD     DNSRecordType = "ZONEMD"
 )
 
 var DNSRecordReverseMap map[DNSRecordType]uint16 = map[DNSRecordType]uint16{
-	DNSRecordTypeA:     dns.TypeA,
-	DNSRecordTypeAAAA:  dns.TypeAAAA,
-	DNSRecordTypePTR:   dns.TypePTR,
-	DNSRecordTypeCNAME: dns.TypeCNAME,
-	DNSRecordTypeNS:    dns.TypeNS,
-	DNSRecordTypeSOA:   dns.TypeSOA,
-	DNSRecordTypeMX:    dns.TypeMX,
-	DNSRecordTypeTXT:   dns.TypeTXT,
+	DNSRecordTypeA:          dns.TypeA,
+	DNSRecordTypeAAAA:       dns.TypeAAAA,
+	DNSRecordTypePTR:        dns.TypePTR,
+	DNSRecordTypeCNAME:      dns.TypeCNAME,
+	DNSRecordTypeNS:         dns.TypeNS,
+	DNSRecordTypeSOA:        dns.TypeSOA,
+	DNSRecordTypeMX:         dns.TypeMX,
+	DNSRecordTypeTXT:        dns.TypeTXT,
+	DNSRecordTypeSRV:        dns.TypeSRV,
+	DNSRecordTypeCAA:        dns.TypeCAA,
+	DNSRecordTypeTLSA:       dns.TypeTLSA,
+	DNSRecordTypeSSHFP:      dns.TypeSSHFP,
+	DNSRecordTypeNAPTR:      dns.TypeNAPTR,
+	DNSRecordTypeOPENPGPKEY: dns.TypeOPENPGPKEY,
+	DNSRecordTypeSMIMEA:     dns.TypeSMIMEA,
+	DNSRecordTypeCERT:       dns.TypeCERT,
+	DNSRecordTypeKX:         dns.TypeKX,
+	DNSRecordTypeRP:         dns.TypeRP,
+	DNSRecordTypeDNSKEY:     dns.TypeDNSKEY,
+	DNSRecordTypeDS:         dns.TypeDS,
+	DNSRecordTypeRRSIG:      dns.TypeRRSIG,
+	DNSRecordTypeNSEC:       dns.TypeNSEC,
+	DNSRecordTypeAFSDB:      dns.TypeAFSDB,
+	DNSRecordTypeSVCB:       dns.TypeSVCB,
+	DNSRecordTypeHTTPS:      dns.TypeHTTPS,
+	DNSRecordTypeZONEMD:     dns.TypeZONEMD,
 }
 
 type DNSRecord struct {
@@ -54,12 +96,38 @@ type DNSRecord struct {
 	Value         string        `json:"value"`
 	AbsoluteValue string        `json:"absolute_value"`
 	FQDN          string        `json:"fqdn"`
+	// DisablePTR marks address records NetBox creates no PTR record for
+	DisablePTR bool `json:"disable_ptr"`
+	// CustomFields holds the values of the NetBox custom fields of the record
+	CustomFields map[string]json.RawMessage `json:"custom_fields,omitempty"`
+	// Zone is the zone of the record, relative targets are qualified against it
+	Zone struct {
+		Name string `json:"name"`
+	} `json:"zone"`
+}
+
+// customTTL returns the TTL set in the custom field name of the record, it is
+// not set if the field is missing, null or not a valid TTL
+func (r *DNSRecord) customTTL(name string) (uint32, bool) {
+	value, ok := r.CustomFields[name]
+	if !ok {
+		return 0, false
+	}
+	var ttl *uint32
+	if err := json.Unmarshal(value, &ttl); err != nil {
+		log.Warningf("Ignoring custom field '%s' of %s %s: %s", name, r.FQDN, r.Type, err)
+		return 0, false
+	}
+	if ttl == nil {
+		return 0, false
+	}
+	return *ttl, true
 }
 
 func (r *DNSRecord) RR() dns.RR {
 	var rr dns.RR
 	header := dns.RR_Header{
-		Name:   r.FQDN,
+		Name:   dns.CanonicalName(r.FQDN),
 		Rrtype: DNSRecordReverseMap[r.Type],
 		Class:  dns.ClassINET,
 		Ttl:    r.TTL,
@@ -78,17 +146,17 @@ func (r *DNSRecord) RR() dns.RR {
 	case DNSRecordTypeCNAME:
 		rr = &dns.CNAME{
 			Hdr:    header,
-			Target: r.AbsoluteValue,
+			Target: r.absolute(r.AbsoluteValue),
 		}
 	case DNSRecordTypePTR:
 		rr = &dns.PTR{
 			Hdr: header,
-			Ptr: r.AbsoluteValue,
+			Ptr: r.absolute(r.AbsoluteValue),
 		}
 	case DNSRecordTypeNS:
 		rr = &dns.NS{
 			Hdr: header,
-			Ns:  r.AbsoluteValue,
+			Ns:  r.absolute(r.AbsoluteValue),
 		}
 	case DNSRecordTypeMX:
 		// we receive "[pref] [host]" from Netbox Plugin
@@ -105,22 +173,418 @@ func (r *DNSRecord) RR() dns.RR {
 		rr = &dns.MX{
 			Hdr:        header,
 			Preference: uint16(preference),
-			Mx:         prefAndHost[1],
+			Mx:         r.absolute(prefAndHost[1]),
 		}
 	case DNSRecordTypeTXT:
 		rr = &dns.TXT{
 			Hdr: header,
-			Txt: []string{
-				r.AbsoluteValue,
-			},
+			Txt: splitTXT(r.AbsoluteValue),
+		}
+	case DNSRecordTypeSRV:
+		// we receive "[priority] [weight] [port] [target]" from Netbox Plugin
+		fields := strings.Fields(r.AbsoluteValue)
+		if len(fields) != 4 {
+			log.Error("received malformed SRV record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		values, err := parseUints(fields[:3], 16)
+		if err != nil {
+			log.Errorf("can not parse int from Netbox SRV record: %s", err.Error())
+			return &dns.NULL{}
+		}
+		rr = &dns.SRV{
+			Hdr:      header,
+			Priority: uint16(values[0]),
+			Weight:   uint16(values[1]),
+			Port:     uint16(values[2]),
+			Target:   r.absolute(fields[3]),
+		}
+	case DNSRecordTypeCAA:
+		// we receive "[flag] [tag] [value]" from Netbox Plugin, value is quoted
+		// and may itself contain spaces
+		fields := strings.SplitN(r.AbsoluteValue, " ", 3)
+		if len(fields) != 3 {
+			log.Error("received malformed CAA record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		flag, err := strconv.ParseUint(fields[0], 10, 8)
+		if err != nil {
+			log.Errorf("can not parse int from Netbox CAA record: %s", err.Error())
+			return &dns.NULL{}
+		}
+		value := fields[2]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		rr = &dns.CAA{
+			Hdr:   header,
+			Flag:  uint8(flag),
+			Tag:   fields[1],
+			Value: value,
+		}
+	case DNSRecordTypeTLSA:
+		// we receive "[usage] [selector] [matching type] [certificate]" from Netbox Plugin
+		fields := strings.Fields(r.AbsoluteValue)
+		if len(fields) != 4 {
+			log.Error("received malformed TLSA record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		values, err := parseUints(fields[:3], 8)
+		if err != nil {
+			log.Errorf("can not parse int from Netbox TLSA record: %s", err.Error())
+			return &dns.NULL{}
+		}
+		rr = &dns.TLSA{
+			Hdr:          header,
+			Usage:        uint8(values[0]),
+			Selector:     uint8(values[1]),
+			MatchingType: uint8(values[2]),
+			Certificate:  fields[3],
+		}
+	case DNSRecordTypeSSHFP:
+		// we receive "[algorithm] [type] [fingerprint]" from Netbox Plugin
+		fields := strings.Fields(r.AbsoluteValue)
+		if len(fields) != 3 {
+			log.Error("received malformed SSHFP record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		values, err := parseUints(fields[:2], 8)
+		if err != nil {
+			log.Errorf("can not parse int from Netbox SSHFP record: %s", err.Error())
+			return &dns.NULL{}
+		}
+		rr = &dns.SSHFP{
+			Hdr:         header,
+			Algorithm:   uint8(values[0]),
+			Type:        uint8(values[1]),
+			FingerPrint: fields[2],
+		}
+	case DNSRecordTypeNAPTR:
+		// we receive "[order] [preference] "[flags]" "[service]" "[regexp]" [replacement]"
+		// from Netbox Plugin, the quoted strings may contain spaces
+		fields, err := splitQuoted(r.AbsoluteValue)
+		if err != nil || len(fields) != 6 {
+			log.Error("received malformed NAPTR record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		values, err := parseUints(fields[:2], 16)
+		if err != nil {
+			log.Errorf("can not parse int from Netbox NAPTR record: %s", err.Error())
+			return &dns.NULL{}
+		}
+		rr = &dns.NAPTR{
+			Hdr:         header,
+			Order:       uint16(values[0]),
+			Preference:  uint16(values[1]),
+			Flags:       fields[2],
+			Service:     fields[3],
+			Regexp:      fields[4],
+			Replacement: r.absolute(fields[5]),
+		}
+	case DNSRecordTypeOPENPGPKEY:
+		// we receive the base64 encoded public key from Netbox Plugin, it may be
+		// split into several chunks
+		key := strings.Join(strings.Fields(r.AbsoluteValue), "")
+		if _, err := base64.StdEncoding.DecodeString(key); err != nil || key == "" {
+			log.Error("received malformed OPENPGPKEY record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		rr = &dns.OPENPGPKEY{
+			Hdr:       header,
+			PublicKey: key,
+		}
+	case DNSRecordTypeSMIMEA:
+		// we receive "[usage] [selector] [matching type] [certificate]" from Netbox Plugin
+		fields := strings.Fields(r.AbsoluteValue)
+		if len(fields) != 4 {
+			log.Error("received malformed SMIMEA record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		values, err := parseUints(fields[:3], 8)
+		if err != nil {
+			log.Errorf("can not parse int from Netbox SMIMEA record: %s", err.Error())
+			return &dns.NULL{}
+		}
+		rr = &dns.SMIMEA{
+			Hdr:          header,
+			Usage:        uint8(values[0]),
+			Selector:     uint8(values[1]),
+			MatchingType: uint8(values[2]),
+			Certificate:  fields[3],
+		}
+	case DNSRecordTypeCERT:
+		// we receive "[type] [key tag] [algorithm] [certificate]" from Netbox
+		// Plugin, type and algorithm may be given as mnemonic and the base64
+		// encoded certificate may be split into several chunks
+		fields := strings.Fields(r.AbsoluteValue)
+		if len(fields) < 4 {
+			log.Error("received malformed CERT record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		certType, ok := dns.StringToCertType[strings.ToUpper(fields[0])]
+		if !ok {
+			value, err := strconv.ParseUint(fields[0], 10, 16)
+			if err != nil {
+				log.Errorf("can not parse int from Netbox CERT record: %s", err.Error())
+				return &dns.NULL{}
+			}
+			certType = uint16(value)
+		}
+		keyTag, err := strconv.ParseUint(fields[1], 10, 16)
+		if err != nil {
+			log.Errorf("can not parse int from Netbox CERT record: %s", err.Error())
+			return &dns.NULL{}
+		}
+		algorithm, ok := dns.StringToAlgorithm[strings.ToUpper(fields[2])]
+		if !ok {
+			value, err := strconv.ParseUint(fields[2], 10, 8)
+			if err != nil {
+				log.Errorf("can not parse int from Netbox CERT record: %s", err.Error())
+				return &dns.NULL{}
+			}
+			algorithm = uint8(value)
+		}
+		certificate := strings.Join(fields[3:], "")
+		if _, err := base64.StdEncoding.DecodeString(certificate); err != nil {
+			log.Error("received malformed CERT record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		rr = &dns.CERT{
+			Hdr:         header,
+			Type:        certType,
+			KeyTag:      uint16(keyTag),
+			Algorithm:   algorithm,
+			Certificate: certificate,
+		}
+	case DNSRecordTypeKX:
+		// we receive "[preference] [exchanger]" from Netbox Plugin
+		fields := strings.Fields(r.AbsoluteValue)
+		if len(fields) != 2 {
+			log.Error("received malformed KX record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		values, err := parseUints(fields[:1], 16)
+		if err != nil {
+			log.Errorf("can not parse int from Netbox KX record: %s", err.Error())
+			return &dns.NULL{}
+		}
+		rr = &dns.KX{
+			Hdr:        header,
+			Preference: uint16(values[0]),
+			Exchanger:  r.absolute(fields[1]),
+		}
+	case DNSRecordTypeRP:
+		// we receive "[mbox] [txt]" from Netbox Plugin
+		fields := strings.Fields(r.AbsoluteValue)
+		if len(fields) != 2 {
+			log.Error("received malformed RP record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		rr = &dns.RP{
+			Hdr:  header,
+			Mbox: r.absolute(fields[0]),
+			Txt:  r.absolute(fields[1]),
+		}
+	case DNSRecordTypeAFSDB:
+		// we receive "[subtype] [hostname]" from Netbox Plugin
+		fields := strings.Fields(r.AbsoluteValue)
+		if len(fields) != 2 {
+			log.Error("received malformed AFSDB record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		values, err := parseUints(fields[:1], 16)
+		if err != nil {
+			log.Errorf("can not parse int from Netbox AFSDB record: %s", err.Error())
+			return &dns.NULL{}
+		}
+		rr = &dns.AFSDB{
+			Hdr:      header,
+			Subtype:  uint16(values[0]),
+			Hostname: r.absolute(fields[1]),
+		}
+	case DNSRecordTypeSVCB, DNSRecordTypeHTTPS:
+		// we receive "[priority] [target] [key=value...]" from Netbox Plugin
+		svcb, err := r.parseSVCB(header, r.AbsoluteValue)
+		if err != nil {
+			log.Errorf("received malformed %s record from Netbox: %s", r.Type, err)
+			return &dns.NULL{}
+		}
+		if r.Type == DNSRecordTypeHTTPS {
+			rr = &dns.HTTPS{SVCB: *svcb}
+		} else {
+			rr = svcb
+		}
+	case DNSRecordTypeZONEMD:
+		// we receive "[serial] [scheme] [hash algorithm] [digest]" from Netbox Plugin
+		fields := strings.Fields(r.AbsoluteValue)
+		if len(fields) != 4 {
+			log.Error("received malformed ZONEMD record from Netbox. Abort.")
+			return &dns.NULL{}
+		}
+		serial, err := parseUints(fields[:1], 32)
+		if err != nil {
+			log.Errorf("can not parse int from Netbox ZONEMD record: %s", err.Error())
+			return &dns.NULL{}
 		}
+		values, err := parseUints(fields[1:3], 8)
+		if err != nil {
+			log.Errorf("can not parse int from Netbox ZONEMD record: %s", err.Error())
+			return &dns.NULL{}
+		}
+		if _, err := hex.DecodeString(fields[3]); err != nil {
+			log.Errorf("received malformed ZONEMD digest from Netbox: %s", err.Error())
+			return &dns.NULL{}
+		}
+		rr = &dns.ZONEMD{
+			Hdr:    header,
+			Serial: uint32(serial[0]),
+			Scheme: uint8(values[0]),
+			Hash:   uint8(values[1]),
+			Digest: strings.ToLower(fields[3]),
+		}
+	case DNSRecordTypeDNSKEY, DNSRecordTypeDS, DNSRecordTypeRRSIG, DNSRecordTypeNSEC:
+		// the records of pre-signed zones are kept in presentation format
+		parsed, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", header.Name, header.Ttl, r.Type, r.AbsoluteValue))
+		if err != nil || parsed == nil {
+			log.Errorf("received malformed %s record from Netbox: %v", r.Type, err)
+			return &dns.NULL{}
+		}
+		rr = parsed
 	default:
 		return &dns.NULL{}
 	}
 	return rr
 }
 
+// parseSVCB parses the priority, the target and the alpn, port, ipv4hint and
+// ipv6hint parameters of a SVCB or HTTPS record
+func (r *DNSRecord) parseSVCB(header dns.RR_Header, value string) (*dns.SVCB, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("missing priority or target")
+	}
+	priority, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	svcb := &dns.SVCB{Hdr: header, Priority: uint16(priority), Target: r.absolute(fields[1])}
+	if priority == 0 && len(fields) > 2 {
+		return nil, fmt.Errorf("alias form must not have parameters")
+	}
+
+	for _, field := range fields[2:] {
+		key, val, _ := strings.Cut(field, "=")
+		val = strings.Trim(val, `"`)
+		switch key {
+		case "alpn":
+			svcb.Value = append(svcb.Value, &dns.SVCBAlpn{Alpn: strings.Split(val, ",")})
+		case "port":
+			port, err := strconv.ParseUint(val, 10, 16)
+			if err != nil {
+				return nil, err
+			}
+			svcb.Value = append(svcb.Value, &dns.SVCBPort{Port: uint16(port)})
+		case "ipv4hint", "ipv6hint":
+			var hints []net.IP
+			for _, addr := range strings.Split(val, ",") {
+				ip := net.ParseIP(addr)
+				if ip == nil || (ip.To4() != nil) != (key == "ipv4hint") {
+					return nil, fmt.Errorf("invalid %s %q", key, addr)
+				}
+				hints = append(hints, ip)
+			}
+			if key == "ipv4hint" {
+				svcb.Value = append(svcb.Value, &dns.SVCBIPv4Hint{Hint: hints})
+			} else {
+				svcb.Value = append(svcb.Value, &dns.SVCBIPv6Hint{Hint: hints})
+			}
+		default:
+			return nil, fmt.Errorf("unsupported parameter %q", key)
+		}
+	}
+	// parameters are kept in the order of their keys
+	slices.SortFunc(svcb.Value, func(a, b dns.SVCBKeyValue) int {
+		return int(a.Key()) - int(b.Key())
+	})
+	return svcb, nil
+}
+
+// parseUints parses every field as an unsigned integer of the given bit size
+func parseUints(fields []string, bitSize int) ([]uint64, error) {
+	values := make([]uint64, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseUint(field, 10, bitSize)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// absolute returns the domain name of a record target as absolute name, names
+// without a trailing dot are relative to the zone of the record
+func (r *DNSRecord) absolute(name string) string {
+	if dns.IsFqdn(name) || r.Zone.Name == "" {
+		return dns.Fqdn(name)
+	}
+	return dns.Fqdn(name + "." + r.Zone.Name)
+}
+
+// splitTXT splits s into character-strings of at most 255 bytes, the maximum
+// length of a single string inside a TXT record
+func splitTXT(s string) []string {
+	const maxLen = 255
+	chunks := make([]string, 0, len(s)/maxLen+1)
+	for len(s) > maxLen {
+		chunks = append(chunks, s[:maxLen])
+		s = s[maxLen:]
+	}
+	return append(chunks, s)
+}
+
+// splitQuoted splits s around whitespace like strings.Fields, but keeps double
+// quoted strings together and strips their quotes. Inside quotes a backslash
+// escapes a following quote or backslash.
+func splitQuoted(s string) ([]string, error) {
+	var (
+		fields  []string
+		field   strings.Builder
+		inField bool
+		quoted  bool
+	)
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\'):
+			i++
+			field.WriteRune(runes[i])
+		case c == '"':
+			quoted = !quoted
+			inField = true
+		case !quoted && unicode.IsSpace(c):
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(c)
+			inField = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quoted string")
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
 type DNSRecordsList struct {
+	Next    string      `json:"next"`
 	Records []DNSRecord `json:"results"`
 }
 
@@ -136,13 +600,17 @@ type DNSZone struct {
 	Expire  uint32 `json:"soa_expire"`
 	Minimum uint32 `json:"soa_minimum"`
 	TTL     uint32 `json:"soa_ttl"`
+	// Nameservers are the name servers of the zone served at its apex
+	Nameservers []struct {
+		Name string `json:"name"`
+	} `json:"nameservers"`
 }
 
 func (z *DNSZone) RR() dns.RR {
 	return &dns.SOA{
-		Hdr:     dns.RR_Header{Name: z.Name + ".", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: z.TTL},
-		Ns:      z.MName.Name + ".",
-		Mbox:    z.RName + ".",
+		Hdr:     dns.RR_Header{Name: dns.CanonicalName(z.Name), Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: z.TTL},
+		Ns:      dns.Fqdn(z.MName.Name),
+		Mbox:    dns.Fqdn(z.RName),
 		Serial:  z.Serial,
 		Expire:  z.Expire,
 		Refresh: z.Refresh,
@@ -151,84 +619,390 @@ func (z *DNSZone) RR() dns.RR {
 	}
 }
 
+// NS returns the NS records of the name servers of the zone
+func (z *DNSZone) NS() []dns.RR {
+	var rrs []dns.RR
+	for _, ns := range z.Nameservers {
+		rrs = append(rrs, &dns.NS{
+			Hdr: dns.RR_Header{Name: dns.CanonicalName(z.Name), Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: z.TTL},
+			Ns:  dns.Fqdn(ns.Name),
+		})
+	}
+	return rrs
+}
+
 type DNSZoneList struct {
+	Next  string    `json:"next"`
 	Zones []DNSZone `json:"results"`
 }
 
 type DNSQuerySet string
 
+// Contains reports whether records of type t are selected by the query set
+func (q DNSQuerySet) Contains(t DNSRecordType) bool {
+	params, err := url.ParseQuery(string(q))
+	if err != nil {
+		return false
+	}
+	return slices.Contains(params["type"], string(t))
+}
+
 const (
-	DNSQuerySetA     DNSQuerySet = "type=A&type=CNAME"
-	DNSQuerySetAAAA  DNSQuerySet = "type=AAAA&type=CNAME"
-	DNSQuerySetPTR   DNSQuerySet = "type=PTR"
-	DNSQuerySetCNAME DNSQuerySet = "type=CNAME"
-	DNSQuerySetNS    DNSQuerySet = "type=NS"
-	DNSQuerySetMX    DNSQuerySet = "type=MX"
-	DNSQuerySetTXT   DNSQuerySet = "type=TXT"
+	DNSQuerySetA          DNSQuerySet = "type=A&type=CNAME"
+	DNSQuerySetAAAA       DNSQuerySet = "type=AAAA&type=CNAME"
+	DNSQuerySetPTR        DNSQuerySet = "type=PTR"
+	DNSQuerySetCNAME      DNSQuerySet = "type=CNAME"
+	DNSQuerySetNS         DNSQuerySet = "type=NS"
+	DNSQuerySetMX         DNSQuerySet = "type=MX"
+	DNSQuerySetTXT        DNSQuerySet = "type=TXT"
+	DNSQuerySetSRV        DNSQuerySet = "type=SRV"
+	DNSQuerySetCAA        DNSQuerySet = "type=CAA"
+	DNSQuerySetTLSA       DNSQuerySet = "type=TLSA"
+	DNSQuerySetSSHFP      DNSQuerySet = "type=SSHFP"
+	DNSQuerySetNAPTR      DNSQuerySet = "type=NAPTR"
+	DNSQuerySetOPENPGPKEY DNSQuerySet = "type=OPENPGPKEY"
+	DNSQuerySetSMIMEA     DNSQuerySet = "type=SMIMEA"
+	DNSQuerySetCERT       DNSQuerySet = "type=CERT"
+	DNSQuerySetKX         DNSQuerySet = "type=KX"
+	DNSQuerySetRP         DNSQuerySet = "type=RP"
+	DNSQuerySetDNSKEY     DNSQuerySet = "type=DNSKEY"
+	DNSQuerySetDS         DNSQuerySet = "type=DS"
+	DNSQuerySetRRSIG      DNSQuerySet = "type=RRSIG"
+	DNSQuerySetNSEC       DNSQuerySet = "type=NSEC"
+	DNSQuerySetAFSDB      DNSQuerySet = "type=AFSDB"
+	DNSQuerySetSVCB       DNSQuerySet = "type=SVCB"
+	DNSQuerySetHTTPS      DNSQuerySet = "type=HTTPS"
+	DNSQuerySetZONEMD     DNSQuerySet = "type=ZONEMD"
+
+	// DNSQuerySetANY is bound to the supported record types
+	DNSQuerySetANY DNSQuerySet = "type=A&type=AAAA&type=PTR&type=CNAME&type=NS&type=MX&type=TXT&type=SRV&type=CAA&type=TLSA&type=SSHFP&type=NAPTR&type=OPENPGPKEY&type=SMIMEA&type=CERT&type=KX&type=RP&type=AFSDB&type=SVCB&type=HTTPS&type=ZONEMD"
 )
 
 var DNSQueryReverseMap map[uint16]DNSQuerySet = map[uint16]DNSQuerySet{
-	dns.TypeA:     DNSQuerySetA,
-	dns.TypeAAAA:  DNSQuerySetAAAA,
-	dns.TypePTR:   DNSQuerySetPTR,
-	dns.TypeCNAME: DNSQuerySetCNAME,
-	dns.TypeNS:    DNSQuerySetNS,
-	dns.TypeMX:    DNSQuerySetMX,
-	dns.TypeTXT:   DNSQuerySetTXT,
+	dns.TypeA:          DNSQuerySetA,
+	dns.TypeAAAA:       DNSQuerySetAAAA,
+	dns.TypePTR:        DNSQuerySetPTR,
+	dns.TypeCNAME:      DNSQuerySetCNAME,
+	dns.TypeNS:         DNSQuerySetNS,
+	dns.TypeMX:         DNSQuerySetMX,
+	dns.TypeTXT:        DNSQuerySetTXT,
+	dns.TypeSRV:        DNSQuerySetSRV,
+	dns.TypeCAA:        DNSQuerySetCAA,
+	dns.TypeTLSA:       DNSQuerySetTLSA,
+	dns.TypeSSHFP:      DNSQuerySetSSHFP,
+	dns.TypeNAPTR:      DNSQuerySetNAPTR,
+	dns.TypeOPENPGPKEY: DNSQuerySetOPENPGPKEY,
+	dns.TypeSMIMEA:     DNSQuerySetSMIMEA,
+	dns.TypeCERT:       DNSQuerySetCERT,
+	dns.TypeKX:         DNSQuerySetKX,
+	dns.TypeRP:         DNSQuerySetRP,
+	dns.TypeDNSKEY:     DNSQuerySetDNSKEY,
+	dns.TypeDS:         DNSQuerySetDS,
+	dns.TypeRRSIG:      DNSQuerySetRRSIG,
+	dns.TypeNSEC:       DNSQuerySetNSEC,
+	dns.TypeAFSDB:      DNSQuerySetAFSDB,
+	dns.TypeSVCB:       DNSQuerySetSVCB,
+	dns.TypeHTTPS:      DNSQuerySetHTTPS,
+	dns.TypeZONEMD:     DNSQuerySetZONEMD,
+	dns.TypeANY:        DNSQuerySetANY,
 }
 
-func (n *Netbox) queryRecord(zone string, fqdn string, querySet DNSQuerySet) ([]DNSRecord, error) {
-	var (
-		requrl  = fmt.Sprintf("%s/api/plugins/netbox-dns/records/?zone=%s&fqdn=%s&active=true&%s", n.Url, strings.TrimRight(zone, "."), fqdn, querySet)
-		records DNSRecordsList
-	)
+// pluginURL returns the URL of the netbox-dns endpoint at path with params,
+// requesting pages of the configured size
+func (n *Netbox) pluginURL(path string, params url.Values) string {
+	if n.PageSize > 0 {
+		params.Set("limit", strconv.Itoa(n.PageSize))
+	}
+	return n.queryURL("plugins/netbox-dns/"+path, params)
+}
 
-	// do http request against NetBox instance
-	resp, err := get(n.Client, requrl, n.Token)
+// maxPages bounds the pages of a single result followed
+const maxPages = 10000
+
+// followPages calls get with requrl and every following page until get
+// returns no link to a next page. Only the query of the links is used, so the
+// token is never sent to another scheme, host or path than the configured
+// one, for example if NetBox behind a TLS terminating proxy links to http.
+func followPages(requrl string, get func(pageURL string) (string, error)) error {
+	first, err := url.Parse(requrl)
 	if err != nil {
-		return records.Records, fmt.Errorf("problem performing request: %w", err)
+		return err
 	}
-	// ensure body is closed once we are done
-	defer resp.Body.Close()
+	seen := make(map[string]bool)
+	for pageURL := requrl; ; {
+		if seen[pageURL] {
+			return fmt.Errorf("NetBox links to page %s twice", pageURL)
+		}
+		if len(seen) == maxPages {
+			return fmt.Errorf("NetBox returned more than %d pages for %s", maxPages, requrl)
+		}
+		seen[pageURL] = true
 
-	// status code must be http.StatusOK
-	if resp.StatusCode != http.StatusOK {
-		return records.Records, fmt.Errorf("bad HTTP response code: %d", resp.StatusCode)
+		link, err := get(pageURL)
+		if err != nil {
+			return err
+		}
+		if link == "" {
+			return nil
+		}
+		next, err := url.Parse(link)
+		if err != nil {
+			return fmt.Errorf("invalid link to the next page %s: %s", link, err)
+		}
+		page := *first
+		page.RawQuery = next.RawQuery
+		pageURL = page.String()
+	}
+}
+
+// sharedCall is a request against NetBox shared by concurrent callers
+type sharedCall struct {
+	done    chan struct{}
+	val     interface{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// shared runs fn once for concurrent callers of the same key and returns its
+// result to all of them. Every caller is charged once against the budget of
+// its ctx and waits until its own ctx is done. fn runs detached from the
+// cancellation and the budget of the first caller, bounded by the client
+// timeout, so callers giving up do not fail the others. It is canceled once
+// the last caller gave up or the plugin shuts down.
+func (n *Netbox) shared(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if !spend(ctx) {
+		return nil, errBudgetExhausted
 	}
 
-	// read and parse response body
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&records); err != nil {
-		return records.Records, fmt.Errorf("could not unmarshal response: %w", err)
+	n.requestsMu.Lock()
+	call, ok := n.requests[key]
+	if !ok {
+		reqCtx := context.WithValue(context.WithoutCancel(ctx), budgetKey{}, nil)
+		var cancel context.CancelFunc
+		if n.Client != nil && n.Client.Timeout > 0 {
+			reqCtx, cancel = context.WithTimeout(reqCtx, n.Client.Timeout)
+		} else {
+			reqCtx, cancel = context.WithCancel(reqCtx)
+		}
+		call = &sharedCall{done: make(chan struct{}), cancel: cancel}
+		if n.requests == nil {
+			n.requests = make(map[string]*sharedCall)
+		}
+		n.requests[key] = call
+		go func() {
+			defer close(call.done)
+			defer cancel()
+			call.val, call.err = fn(reqCtx)
+			n.forget(key, call)
+		}()
 	}
+	call.waiters++
+	n.requestsMu.Unlock()
 
-	return records.Records, nil
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		n.requestsMu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// nobody waits for the result anymore
+			call.cancel()
+			n.forgetLocked(key, call)
+		}
+		n.requestsMu.Unlock()
+		return nil, ctx.Err()
+	}
 }
 
-func (n *Netbox) queryZone(zone string) ([]DNSZone, error) {
-	var (
-		requrl = fmt.Sprintf("%s/api/plugins/netbox-dns/zones/?name=%s&active=true", n.Url, strings.TrimSuffix(zone, "."))
-		zones  DNSZoneList
-	)
+// forget removes call from the shared requests, so later callers of key start
+// a new one
+func (n *Netbox) forget(key string, call *sharedCall) {
+	n.requestsMu.Lock()
+	defer n.requestsMu.Unlock()
+	n.forgetLocked(key, call)
+}
+
+// forgetLocked is forget with requestsMu held
+func (n *Netbox) forgetLocked(key string, call *sharedCall) {
+	if n.requests[key] == call {
+		delete(n.requests, key)
+	}
+}
+
+// cancelRequests cancels all shared requests against NetBox still running
+func (n *Netbox) cancelRequests() {
+	n.requestsMu.Lock()
+	defer n.requestsMu.Unlock()
+	for key, call := range n.requests {
+		call.cancel()
+		delete(n.requests, key)
+	}
+}
+
+// queryRecord returns the records of fqdn within zone. Names are matched
+// case-insensitively, NetBox stores them in lower case.
+func (n *Netbox) queryRecord(ctx context.Context, zone, view, fqdn string, querySet DNSQuerySet) ([]DNSRecord, error) {
+	// NetBox keeps the fqdn of records absolute with a single trailing dot,
+	// including the one of records at the zone apex
+	fqdn = dns.Fqdn(strings.TrimRight(strings.ToLower(fqdn), "."))
+	params, err := url.ParseQuery(string(querySet))
+	if err != nil {
+		return nil, err
+	}
+	params.Set("zone", strings.TrimRight(zone, "."))
+	params.Set("fqdn", fqdn)
+	if !n.IncludeInactive {
+		params.Set("active", "true")
+	}
+	if view != "" {
+		params.Set("view", view)
+	}
+	return n.queryRecords(ctx, zone, n.pluginURL("records/", params))
+}
+
+// queryZoneRecords returns all active records of zone apart from its SOA,
+// inactive ones as well if IncludeInactive is set
+func (n *Netbox) queryZoneRecords(ctx context.Context, zone, view string) ([]DNSRecord, error) {
+	params, err := url.ParseQuery(string(DNSQuerySetANY))
+	if err != nil {
+		return nil, err
+	}
+	params.Set("zone", strings.TrimRight(zone, "."))
+	if !n.IncludeInactive {
+		params.Set("active", "true")
+	}
+	if view != "" {
+		params.Set("view", view)
+	}
+	return n.queryRecords(ctx, zone, n.pluginURL("records/", params))
+}
+
+// hasDescendants reports whether zone has records below name, even if name
+// has none itself. A single record is requested as any will do.
+func (n *Netbox) hasDescendants(ctx context.Context, zone, view, name string) (bool, error) {
+	params := url.Values{
+		"zone":      {strings.TrimRight(zone, ".")},
+		"fqdn__iew": {"." + strings.ToLower(dns.Fqdn(name))},
+		"limit":     {"1"},
+	}
+	if !n.IncludeInactive {
+		params.Set("active", "true")
+	}
+	if view != "" {
+		params.Set("view", view)
+	}
+	requrl := n.queryURL("plugins/netbox-dns/records/", params)
+	v, err := n.shared(ctx, requrl, func(reqCtx context.Context) (interface{}, error) {
+		var page DNSRecordsList
+		if err := n.getJSON(reqCtx, endpointRecords, requrl, &page); err != nil {
+			return false, err
+		}
+		return len(page.Records) > 0, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+// queryRecords follows all pages of the records found at requrl
+func (n *Netbox) queryRecords(ctx context.Context, zone, requrl string) ([]DNSRecord, error) {
+	// share a single request against NetBox between concurrent identical
+	// queries, the client timeout bounds following all pages of the result
+	v, err := n.shared(ctx, requrl, func(reqCtx context.Context) (interface{}, error) {
+		var records []DNSRecord
 
-	// do http request against NetBox instance
-	resp, err := get(n.Client, requrl, n.Token)
+		// trace following all pages if the caller is traced
+		if span := startSpan(reqCtx, "netbox "+endpointRecords, zone); span != nil {
+			defer span.Finish()
+			span.SetTag("endpoint", endpointRecords)
+			reqCtx = ot.ContextWithSpan(reqCtx, span)
+		}
+
+		// follow the next page until NetBox returns none
+		err := followPages(requrl, func(pageURL string) (string, error) {
+			var page DNSRecordsList
+			if err := n.getJSON(reqCtx, endpointRecords, pageURL, &page); err != nil {
+				return "", err
+			}
+			records = append(records, page.Records...)
+			return page.Next, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return records, nil
+	})
 	if err != nil {
-		return zones.Zones, fmt.Errorf("problem performing request: %w", err)
+		return nil, err
 	}
-	// ensure body is closed once we are done
-	defer resp.Body.Close()
 
-	// status code must be http.StatusOK
-	if resp.StatusCode != http.StatusOK {
-		return zones.Zones, fmt.Errorf("bad HTTP response code: %d", resp.StatusCode)
+	// every caller gets its own copy as the result is shared
+	records := slices.Clone(v.([]DNSRecord))
+
+	// the TTL of the custom field overrides the one of the record
+	if n.TTLCustomField != "" {
+		for i := range records {
+			if ttl, ok := records[i].customTTL(n.TTLCustomField); ok {
+				records[i].TTL = ttl
+			}
+		}
 	}
+	return records, nil
+}
 
-	// read and parse response body
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&zones); err != nil {
-		return zones.Zones, fmt.Errorf("could not unmarshal response: %w", err)
+func (n *Netbox) queryZone(ctx context.Context, zone, view string) ([]DNSZone, error) {
+	params := url.Values{"name": {strings.TrimSuffix(zone, ".")}}
+	if !n.IncludeInactive {
+		params.Set("active", "true")
+	}
+	if view != "" {
+		params.Set("view", view)
+	}
+	return n.queryZones(ctx, zone, n.pluginURL("zones/", params))
+}
+
+// queryActiveZones returns all active zones of netbox-dns
+func (n *Netbox) queryActiveZones(ctx context.Context) ([]DNSZone, error) {
+	return n.queryZones(ctx, ".", n.pluginURL("zones/", url.Values{"active": {"true"}}))
+}
+
+// queryZones follows all pages of the zones found at requrl
+func (n *Netbox) queryZones(ctx context.Context, zone, requrl string) ([]DNSZone, error) {
+	// share a single request against NetBox between concurrent identical
+	// queries, the client timeout bounds following all pages of the result
+	v, err := n.shared(ctx, requrl, func(reqCtx context.Context) (interface{}, error) {
+		var zones []DNSZone
+
+		// trace following all pages if the caller is traced
+		if span := startSpan(reqCtx, "netbox "+endpointZones, zone); span != nil {
+			defer span.Finish()
+			span.SetTag("endpoint", endpointZones)
+			reqCtx = ot.ContextWithSpan(reqCtx, span)
+		}
+
+		// follow the next page until NetBox returns none
+		err := followPages(requrl, func(pageURL string) (string, error) {
+			var page DNSZoneList
+			if err := n.getJSON(reqCtx, endpointZones, pageURL, &page); err != nil {
+				return "", err
+			}
+			zones = append(zones, page.Zones...)
+			return page.Next, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return zones, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return zones.Zones, nil
+	// every caller gets its own copy as the result is shared
+	return slices.Clone(v.([]DNSZone)), nil
 }
@@ -15,10 +15,22 @@
 package netbox
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/h2non/gock.v1"
 )
@@ -231,6 +243,646 @@ func TestQueryRecord(t *testing.T) {
 				"example.org.\t8600\tIN\tNS\tns1.example.org.",
 			},
 		},
+		{
+			"Query SRV record",
+			"example.org.",
+			"_sip._udp.example.org.",
+			DNSRecordTypeSRV,
+			`{
+				"results": [
+				{
+					"type": "SRV",
+					"ttl": 8600,
+					"value": "10 5 5060 sipserver",
+					"absolute_value": "10 5 5060 sipserver.example.org.",
+					"fqdn": "_sip._udp.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"_sip._udp.example.org.\t8600\tIN\tSRV\t10 5 5060 sipserver.example.org.",
+			},
+		},
+		{
+			"Query CAA record",
+			"example.org.",
+			"example.org.",
+			DNSRecordTypeCAA,
+			`{
+				"results": [
+				{
+					"type": "CAA",
+					"ttl": 8600,
+					"value": "0 issue \"letsencrypt.org\"",
+					"absolute_value": "0 issue \"letsencrypt.org\"",
+					"fqdn": "example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"example.org.\t8600\tIN\tCAA\t0 issue \"letsencrypt.org\"",
+			},
+		},
+		{
+			"Query CAA record with spaces in value",
+			"example.org.",
+			"www.example.org.",
+			DNSRecordTypeCAA,
+			`{
+				"results": [
+				{
+					"type": "CAA",
+					"ttl": 8600,
+					"value": "0 issuewild \"ca.example.net; policy=ev\"",
+					"absolute_value": "0 issuewild \"ca.example.net; policy=ev\"",
+					"fqdn": "www.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"www.example.org.\t8600\tIN\tCAA\t0 issuewild \"ca.example.net; policy=ev\"",
+			},
+		},
+		{
+			"Query TLSA record",
+			"example.org.",
+			"_443._tcp.mail1.example.org.",
+			DNSRecordTypeTLSA,
+			`{
+				"results": [
+				{
+					"type": "TLSA",
+					"ttl": 8600,
+					"value": "3 1 1 d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971",
+					"absolute_value": "3 1 1 d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971",
+					"fqdn": "_443._tcp.mail1.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"_443._tcp.mail1.example.org.\t8600\tIN\tTLSA\t3 1 1 d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971",
+			},
+		},
+		{
+			"Query SSHFP record",
+			"example.org.",
+			"mail1.example.org.",
+			DNSRecordTypeSSHFP,
+			`{
+				"results": [
+				{
+					"type": "SSHFP",
+					"ttl": 8600,
+					"value": "4 2 f0e7c1d9b4a5c2e8a7f3b6d1e9c4a2b8f5d7e3c1a9b6f4d2e8c7a5b3f1d9e6c4",
+					"absolute_value": "4 2 f0e7c1d9b4a5c2e8a7f3b6d1e9c4a2b8f5d7e3c1a9b6f4d2e8c7a5b3f1d9e6c4",
+					"fqdn": "mail1.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"mail1.example.org.\t8600\tIN\tSSHFP\t4 2 F0E7C1D9B4A5C2E8A7F3B6D1E9C4A2B8F5D7E3C1A9B6F4D2E8C7A5B3F1D9E6C4",
+			},
+		},
+		{
+			"Query malformed SSHFP record",
+			"example.org.",
+			"mail2.example.org.",
+			DNSRecordTypeSSHFP,
+			`{
+				"results": [
+				{
+					"type": "SSHFP",
+					"ttl": 8600,
+					"value": "ed25519 2 f0e7c1d9",
+					"absolute_value": "ed25519 2 f0e7c1d9",
+					"fqdn": "mail2.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
+		{
+			"Query NAPTR record",
+			"4.3.2.1.e164.example.org.",
+			"4.3.2.1.e164.example.org.",
+			DNSRecordTypeNAPTR,
+			`{
+				"results": [
+				{
+					"type": "NAPTR",
+					"ttl": 8600,
+					"value": "100 10 \"u\" \"E2U+sip\" \"!^.*$!sip:customer service@example.org!\" .",
+					"absolute_value": "100 10 \"u\" \"E2U+sip\" \"!^.*$!sip:customer service@example.org!\" .",
+					"fqdn": "4.3.2.1.e164.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"4.3.2.1.e164.example.org.\t8600\tIN\tNAPTR\t100 10 \"u\" \"E2U+sip\" \"!^.*$!sip:customer service@example.org!\" .",
+			},
+		},
+		{
+			"Query NAPTR record with replacement",
+			"example.org.",
+			"example.org.",
+			DNSRecordTypeNAPTR,
+			`{
+				"results": [
+				{
+					"type": "NAPTR",
+					"ttl": 8600,
+					"value": "20 0 \"s\" \"SIP+D2U\" \"\" _sip._udp",
+					"absolute_value": "20 0 \"s\" \"SIP+D2U\" \"\" _sip._udp.example.org",
+					"fqdn": "example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"example.org.\t8600\tIN\tNAPTR\t20 0 \"s\" \"SIP+D2U\" \"\" _sip._udp.example.org.",
+			},
+		},
+		{
+			"Query malformed NAPTR record",
+			"example.org.",
+			"mail2.example.org.",
+			DNSRecordTypeNAPTR,
+			`{
+				"results": [
+				{
+					"type": "NAPTR",
+					"ttl": 8600,
+					"value": "20 0 \"s\" \"SIP+D2U _sip._udp",
+					"absolute_value": "20 0 \"s\" \"SIP+D2U _sip._udp.example.org",
+					"fqdn": "mail2.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
+		{
+			"Query OPENPGPKEY record",
+			"example.org.",
+			"c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._openpgpkey.example.org.",
+			DNSRecordTypeOPENPGPKEY,
+			`{
+				"results": [
+				{
+					"type": "OPENPGPKEY",
+					"ttl": 8600,
+					"value": "mQENBFVHm5sBCADPs4KoRXiEfFSxpL5pfNdPE+7l0vyb8G2PfKQa3KxbLq0+6XkHQR9Td4kqOmtFgu0hZ2CIdjdF8Ir8F7ipRjgGeKpNFP2OqVAs1cbCejvNRcMgFvn5iNnz/BuUmxrNkHPmn6mHzqX4E7rxGpDWMYYjzSYxXG3CF9p5IDeBf/d0HXfxuVsDvGu2IOiQ6sThPb0ZqCjXmH8fsgGx61eTYZYJsqp9W6QpqEtdDEYP1a4NSgkPpjHBQ2xoWnbz5v4gqJe8r5UkH6kSJj2Y8kqCn9wvLvYhMPTPLDJYaWw2f8HJ6G3N2bxqHDj2w3o2ZtxqvxqhI1rOTiVYKQBbr8jqBkLPABEBAAG0HGhvc3RtYXN0ZXIgPGhvc3RtYXN0ZXJAZXhhbXBsZS5vcmc+",
+					"absolute_value": "mQENBFVHm5sBCADPs4KoRXiEfFSxpL5pfNdPE+7l0vyb8G2PfKQa3KxbLq0+6XkHQR9Td4kqOmtFgu0hZ2CIdjdF8Ir8F7ipRjgGeKpNFP2OqVAs1cbCejvNRcMgFvn5iNnz/BuUmxrNkHPmn6mHzqX4E7rxGpDWMYYjzSYxXG3CF9p5IDeBf/d0HXfxuVsDvGu2IOiQ6sThPb0ZqCjXmH8fsgGx61eTYZYJsqp9W6QpqEtdDEYP1a4NSgkPpjHBQ2xoWnbz5v4gqJe8r5UkH6kSJj2Y8kqCn9wvLvYhMPTPLDJYaWw2f8HJ6G3N2bxqHDj2w3o2ZtxqvxqhI1rOTiVYKQBbr8jqBkLPABEBAAG0HGhvc3RtYXN0ZXIgPGhvc3RtYXN0ZXJAZXhhbXBsZS5vcmc+",
+					"fqdn": "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._openpgpkey.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._openpgpkey.example.org.\t8600\tIN\tOPENPGPKEY\tmQENBFVHm5sBCADPs4KoRXiEfFSxpL5pfNdPE+7l0vyb8G2PfKQa3KxbLq0+6XkHQR9Td4kqOmtFgu0hZ2CIdjdF8Ir8F7ipRjgGeKpNFP2OqVAs1cbCejvNRcMgFvn5iNnz/BuUmxrNkHPmn6mHzqX4E7rxGpDWMYYjzSYxXG3CF9p5IDeBf/d0HXfxuVsDvGu2IOiQ6sThPb0ZqCjXmH8fsgGx61eTYZYJsqp9W6QpqEtdDEYP1a4NSgkPpjHBQ2xoWnbz5v4gqJe8r5UkH6kSJj2Y8kqCn9wvLvYhMPTPLDJYaWw2f8HJ6G3N2bxqHDj2w3o2ZtxqvxqhI1rOTiVYKQBbr8jqBkLPABEBAAG0HGhvc3RtYXN0ZXIgPGhvc3RtYXN0ZXJAZXhhbXBsZS5vcmc+",
+			},
+		},
+		{
+			"Query malformed OPENPGPKEY record",
+			"example.org.",
+			"mail2.example.org.",
+			DNSRecordTypeOPENPGPKEY,
+			`{
+				"results": [
+				{
+					"type": "OPENPGPKEY",
+					"ttl": 8600,
+					"value": "not base64!",
+					"absolute_value": "not base64!",
+					"fqdn": "mail2.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
+		{
+			"Query SMIMEA record",
+			"example.org.",
+			"c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert.example.org.",
+			DNSRecordTypeSMIMEA,
+			`{
+				"results": [
+				{
+					"type": "SMIMEA",
+					"ttl": 8600,
+					"value": "3 1 1 d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971",
+					"absolute_value": "3 1 1 d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971",
+					"fqdn": "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert.example.org.\t8600\tIN\tSMIMEA\t3 1 1 d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971",
+			},
+		},
+		{
+			"Query malformed SMIMEA record",
+			"example.org.",
+			"mail2.example.org.",
+			DNSRecordTypeSMIMEA,
+			`{
+				"results": [
+				{
+					"type": "SMIMEA",
+					"ttl": 8600,
+					"value": "3 1 d2abde240d7cd3ee",
+					"absolute_value": "3 1 d2abde240d7cd3ee",
+					"fqdn": "mail2.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
+		{
+			"Query CERT record",
+			"example.org.",
+			"mail1.example.org.",
+			DNSRecordTypeCERT,
+			`{
+				"results": [
+				{
+					"type": "CERT",
+					"ttl": 8600,
+					"value": "1 12345 8 MIIBIjANBgkqhkiG9w0BAQEF AAOCAQ8AMIIBCgKCAQEA",
+					"absolute_value": "1 12345 8 MIIBIjANBgkqhkiG9w0BAQEF AAOCAQ8AMIIBCgKCAQEA",
+					"fqdn": "mail1.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"mail1.example.org.\t8600\tIN\tCERT\tPKIX 12345 RSASHA256 MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA",
+			},
+		},
+		{
+			"Query CERT record with mnemonics",
+			"example.org.",
+			"mail2.example.org.",
+			DNSRecordTypeCERT,
+			`{
+				"results": [
+				{
+					"type": "CERT",
+					"ttl": 8600,
+					"value": "PKIX 12345 RSASHA256 MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA",
+					"absolute_value": "PKIX 12345 RSASHA256 MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA",
+					"fqdn": "mail2.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"mail2.example.org.\t8600\tIN\tCERT\tPKIX 12345 RSASHA256 MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA",
+			},
+		},
+		{
+			"Query malformed CERT record",
+			"example.org.",
+			"mail3.example.org.",
+			DNSRecordTypeCERT,
+			`{
+				"results": [
+				{
+					"type": "CERT",
+					"ttl": 8600,
+					"value": "PKIX 123456 RSASHA256 MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA",
+					"absolute_value": "PKIX 123456 RSASHA256 MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA",
+					"fqdn": "mail3.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
+		{
+			"Query KX record",
+			"example.org.",
+			"host1.example.org.",
+			DNSRecordTypeKX,
+			`{
+				"results": [
+				{
+					"type": "KX",
+					"ttl": 8600,
+					"value": "10 kx1",
+					"absolute_value": "10 kx1.example.org.",
+					"fqdn": "host1.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"host1.example.org.\t8600\tIN\tKX\t10 kx1.example.org.",
+			},
+		},
+		{
+			"Query malformed KX record",
+			"example.org.",
+			"host2.example.org.",
+			DNSRecordTypeKX,
+			`{
+				"results": [
+				{
+					"type": "KX",
+					"ttl": 8600,
+					"value": "kx1",
+					"absolute_value": "kx1.example.org.",
+					"fqdn": "host2.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
+		{
+			"Query KX record with invalid preference",
+			"example.org.",
+			"host3.example.org.",
+			DNSRecordTypeKX,
+			`{
+				"results": [
+				{
+					"type": "KX",
+					"ttl": 8600,
+					"value": "70000 kx1",
+					"absolute_value": "70000 kx1.example.org.",
+					"fqdn": "host3.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
+		{
+			"Query RP record",
+			"example.org.",
+			"host1.example.org.",
+			DNSRecordTypeRP,
+			`{
+				"results": [
+				{
+					"type": "RP",
+					"ttl": 8600,
+					"value": "hostmaster.example.org. contact",
+					"absolute_value": "hostmaster.example.org. contact.example.org.",
+					"fqdn": "host1.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"host1.example.org.\t8600\tIN\tRP\thostmaster.example.org. contact.example.org.",
+			},
+		},
+		{
+			"Query RP record without trailing dots",
+			"example.org.",
+			"host2.example.org.",
+			DNSRecordTypeRP,
+			`{
+				"results": [
+				{
+					"type": "RP",
+					"ttl": 8600,
+					"value": "hostmaster.example.org contact.example.org",
+					"absolute_value": "hostmaster.example.org contact.example.org",
+					"fqdn": "host2.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"host2.example.org.\t8600\tIN\tRP\thostmaster.example.org. contact.example.org.",
+			},
+		},
+		{
+			"Query malformed RP record",
+			"example.org.",
+			"host3.example.org.",
+			DNSRecordTypeRP,
+			`{
+				"results": [
+				{
+					"type": "RP",
+					"ttl": 8600,
+					"value": "hostmaster.example.org.",
+					"absolute_value": "hostmaster.example.org.",
+					"fqdn": "host3.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
+		{
+			"Query DS record",
+			"example.org.",
+			"sub.example.org.",
+			DNSRecordTypeDS,
+			`{
+				"results": [
+				{
+					"type": "DS",
+					"ttl": 8600,
+					"value": "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+					"absolute_value": "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+					"fqdn": "sub.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"sub.example.org.\t8600\tIN\tDS\t60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+			},
+		},
+		{
+			"Query malformed DS record",
+			"example.org.",
+			"sub2.example.org.",
+			DNSRecordTypeDS,
+			`{
+				"results": [
+				{
+					"type": "DS",
+					"ttl": 8600,
+					"value": "60485 5",
+					"absolute_value": "60485 5",
+					"fqdn": "sub2.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
+		{
+			"Query AFSDB record",
+			"example.org.",
+			"afs1.example.org.",
+			DNSRecordTypeAFSDB,
+			`{
+				"results": [
+				{
+					"type": "AFSDB",
+					"ttl": 8600,
+					"value": "1 afsdb1",
+					"absolute_value": "1 afsdb1.example.org",
+					"fqdn": "afs1.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"afs1.example.org.\t8600\tIN\tAFSDB\t1 afsdb1.example.org.",
+			},
+		},
+		{
+			"Query malformed AFSDB record",
+			"example.org.",
+			"afs2.example.org.",
+			DNSRecordTypeAFSDB,
+			`{
+				"results": [
+				{
+					"type": "AFSDB",
+					"ttl": 8600,
+					"value": "1",
+					"absolute_value": "1",
+					"fqdn": "afs2.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
+		{
+			"Query AFSDB record with invalid subtype",
+			"example.org.",
+			"afs3.example.org.",
+			DNSRecordTypeAFSDB,
+			`{
+				"results": [
+				{
+					"type": "AFSDB",
+					"ttl": 8600,
+					"value": "x afsdb1",
+					"absolute_value": "x afsdb1.example.org.",
+					"fqdn": "afs3.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
+		{
+			"Query HTTPS record in alias form",
+			"example.org.",
+			"example.org.",
+			DNSRecordTypeHTTPS,
+			`{
+				"results": [
+				{
+					"type": "HTTPS",
+					"ttl": 300,
+					"value": "0 pool.svc.example.org.",
+					"absolute_value": "0 pool.svc.example.org.",
+					"fqdn": "example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"example.org.\t300\tIN\tHTTPS\t0 pool.svc.example.org.",
+			},
+		},
+		{
+			"Query HTTPS record in service form",
+			"example.org.",
+			"www.example.org.",
+			DNSRecordTypeHTTPS,
+			`{
+				"results": [
+				{
+					"type": "HTTPS",
+					"ttl": 300,
+					"value": "1 . port=8443 alpn=\"h2,h3\" ipv4hint=192.0.2.1,192.0.2.2 ipv6hint=2001:db8::1",
+					"absolute_value": "1 . port=8443 alpn=\"h2,h3\" ipv4hint=192.0.2.1,192.0.2.2 ipv6hint=2001:db8::1",
+					"fqdn": "www.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"www.example.org.\t300\tIN\tHTTPS\t1 . alpn=\"h2,h3\" port=\"8443\" ipv4hint=\"192.0.2.1,192.0.2.2\" ipv6hint=\"2001:db8::1\"",
+			},
+		},
+		{
+			"Query SVCB record in service form",
+			"example.org.",
+			"_dns.example.org.",
+			DNSRecordTypeSVCB,
+			`{
+				"results": [
+				{
+					"type": "SVCB",
+					"ttl": 300,
+					"value": "2 dns.example.org alpn=dot port=853",
+					"absolute_value": "2 dns.example.org alpn=dot port=853",
+					"fqdn": "_dns.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				"_dns.example.org.\t300\tIN\tSVCB\t2 dns.example.org. alpn=\"dot\" port=\"853\"",
+			},
+		},
+		{
+			"Query HTTPS record in alias form with parameters",
+			"example.org.",
+			"alias.example.org.",
+			DNSRecordTypeHTTPS,
+			`{
+				"results": [
+				{
+					"type": "HTTPS",
+					"ttl": 300,
+					"value": "0 pool.svc.example.org. port=443",
+					"absolute_value": "0 pool.svc.example.org. port=443",
+					"fqdn": "alias.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
+		{
+			"Query SVCB record with IPv6 address as ipv4hint",
+			"example.org.",
+			"svc.example.org.",
+			DNSRecordTypeSVCB,
+			`{
+				"results": [
+				{
+					"type": "SVCB",
+					"ttl": 300,
+					"value": "1 . ipv4hint=2001:db8::1",
+					"absolute_value": "1 . ipv4hint=2001:db8::1",
+					"fqdn": "svc.example.org."
+				}]
+			}`,
+			false,
+			[]string{
+				(&dns.NULL{}).String(),
+			},
+		},
 		{
 			"Query not existing record",
 			"example.org.",
@@ -251,6 +903,8 @@ func TestQueryRecord(t *testing.T) {
 		},
 	}
 
+	defer gock.Off() // Flush pending mocks after test execution
+
 	// set up mock responses
 	for _, tt := range tests {
 		gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
@@ -264,7 +918,7 @@ func TestQueryRecord(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		responses, err := n.queryRecord(tt.zone, tt.fqdn, DNSQuerySet(fmt.Sprintf("type=%s", tt.rType)))
+		responses, err := n.queryRecord(context.Background(), tt.zone, "", tt.fqdn, DNSQuerySet(fmt.Sprintf("type=%s", tt.rType)))
 		if tt.wantErr {
 			assert.Error(t, err, tt.name)
 		} else {
@@ -278,6 +932,421 @@ func TestQueryRecord(t *testing.T) {
 	}
 }
 
+func TestLongTXTRecord(t *testing.T) {
+	record := DNSRecord{
+		Type:          DNSRecordTypeTXT,
+		TTL:           8600,
+		Value:         strings.Repeat("a", 600),
+		AbsoluteValue: strings.Repeat("a", 600),
+		FQDN:          "selector._domainkey.example.org.",
+	}
+
+	txt, ok := record.RR().(*dns.TXT)
+	if assert.True(t, ok) && assert.Len(t, txt.Txt, 3) {
+		assert.Len(t, txt.Txt[0], 255)
+		assert.Len(t, txt.Txt[1], 255)
+		assert.Len(t, txt.Txt[2], 90)
+	}
+}
+
+func TestRecordTargetsAbsolute(t *testing.T) {
+	tests := []struct {
+		rrtype DNSRecordType
+		value  string
+		want   string
+	}{
+		{DNSRecordTypeCNAME, "web1.example.org", "host1.example.org.\t300\tIN\tCNAME\tweb1.example.org."},
+		{DNSRecordTypePTR, "web1.example.org", "host1.example.org.\t300\tIN\tPTR\tweb1.example.org."},
+		{DNSRecordTypeNS, "ns1.example.org", "host1.example.org.\t300\tIN\tNS\tns1.example.org."},
+		{DNSRecordTypeMX, "10 mail1.example.org", "host1.example.org.\t300\tIN\tMX\t10 mail1.example.org."},
+		{DNSRecordTypeSRV, "0 5 5060 sip1.example.org", "host1.example.org.\t300\tIN\tSRV\t0 5 5060 sip1.example.org."},
+	}
+
+	for _, tt := range tests {
+		for _, value := range []string{tt.value, tt.value + "."} {
+			record := DNSRecord{Type: tt.rrtype, TTL: 300, Value: value, AbsoluteValue: value, FQDN: "host1.example.org."}
+			assert.Equal(t, tt.want, record.RR().String(), value)
+		}
+	}
+
+	relative := []struct {
+		rrtype DNSRecordType
+		value  string
+		want   string
+	}{
+		{DNSRecordTypeCNAME, "web1", "host1.example.org.\t300\tIN\tCNAME\tweb1.example.org."},
+		{DNSRecordTypeNS, "ns1.sub", "host1.example.org.\t300\tIN\tNS\tns1.sub.example.org."},
+		{DNSRecordTypeMX, "10 mail1", "host1.example.org.\t300\tIN\tMX\t10 mail1.example.org."},
+		{DNSRecordTypeMX, "10 mail1.example.net.", "host1.example.org.\t300\tIN\tMX\t10 mail1.example.net."},
+		{DNSRecordTypeSRV, "0 5 5060 sip1", "host1.example.org.\t300\tIN\tSRV\t0 5 5060 sip1.example.org."},
+		{DNSRecordTypeHTTPS, "1 .", "host1.example.org.\t300\tIN\tHTTPS\t1 ."},
+	}
+
+	for _, tt := range relative {
+		record := DNSRecord{Type: tt.rrtype, TTL: 300, Value: tt.value, AbsoluteValue: tt.value, FQDN: "host1.example.org."}
+		record.Zone.Name = "example.org"
+		assert.Equal(t, tt.want, record.RR().String(), tt.value)
+	}
+
+	for _, name := range []string{"ns1.example.org", "ns1.example.org."} {
+		zone := DNSZone{Name: "example.org", TTL: 300, RName: "admin.example.org"}
+		zone.MName.Name = name
+		soa, ok := zone.RR().(*dns.SOA)
+		if assert.True(t, ok, name) {
+			assert.Equal(t, "ns1.example.org.", soa.Ns, name)
+			assert.Equal(t, "admin.example.org.", soa.Mbox, name)
+		}
+	}
+}
+
+func TestZONEMDRecord(t *testing.T) {
+	record := DNSRecord{
+		Type:          DNSRecordTypeZONEMD,
+		TTL:           86400,
+		Value:         "2025010101 1 1 0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF",
+		AbsoluteValue: "2025010101 1 1 0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF",
+		FQDN:          "example.org.",
+	}
+
+	zonemd, ok := record.RR().(*dns.ZONEMD)
+	if assert.True(t, ok) {
+		assert.Equal(t, dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeZONEMD, Class: dns.ClassINET, Ttl: 86400}, zonemd.Hdr)
+		assert.Equal(t, uint32(2025010101), zonemd.Serial)
+		assert.Equal(t, uint8(1), zonemd.Scheme)
+		assert.Equal(t, uint8(1), zonemd.Hash)
+		assert.Equal(t, "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", zonemd.Digest)
+	}
+
+	for _, value := range []string{
+		"2025010101 1 1",
+		"2025010101 1 256 0123456789abcdef",
+		"4294967296 1 1 0123456789abcdef",
+		"2025010101 1 1 not-hex",
+	} {
+		record.AbsoluteValue = value
+		assert.Equal(t, &dns.NULL{}, record.RR(), value)
+	}
+}
+
+func TestRPRecordRoundTrip(t *testing.T) {
+	record := DNSRecord{
+		Type:          DNSRecordTypeRP,
+		TTL:           8600,
+		Value:         "hostmaster contact",
+		AbsoluteValue: "hostmaster.example.org contact.example.org",
+		FQDN:          "host1.example.org.",
+	}
+
+	rp, ok := record.RR().(*dns.RP)
+	if !assert.True(t, ok) {
+		return
+	}
+	parsed, err := dns.NewRR(rp.String())
+	if assert.NoError(t, err) {
+		assert.Equal(t, rp, parsed)
+	}
+}
+
+func TestQueryRecordFQDN(t *testing.T) {
+	tests := []struct {
+		name     string
+		zone     string
+		fqdn     string
+		wantZone string
+		wantFQDN string
+	}{
+		{"apex", "example.org.", "example.org.", "example.org", "example.org."},
+		{"relative apex", "example.org", "example.org", "example.org", "example.org."},
+		{"apex with doubled dot", "example.org.", "example.org..", "example.org", "example.org."},
+		{"mixed case apex", "example.org.", "Example.ORG.", "example.org", "example.org."},
+		{"subdomain", "example.org.", "host1.example.org.", "example.org", "host1.example.org."},
+		{"relative subdomain", "example.org.", "host1.example.org", "example.org", "host1.example.org."},
+		{"nested subdomain", "example.org.", "a.b.c.d.host1.example.org.", "example.org", "a.b.c.d.host1.example.org."},
+		{"relative nested subdomain", "example.org", "A.b.C.d.host1.example.org", "example.org", "a.b.c.d.host1.example.org."},
+		{"nested zone apex", "sub.dept.example.org.", "sub.dept.example.org.", "sub.dept.example.org", "sub.dept.example.org."},
+	}
+
+	for _, tt := range tests {
+		var query url.Values
+		netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			_, _ = w.Write([]byte(`{"results": []}`))
+		}))
+
+		n := newNetbox()
+		n.Url = netbox.URL
+		n.Token = "mytoken"
+
+		_, err := n.queryRecord(context.Background(), tt.zone, "", tt.fqdn, DNSQuerySetA)
+		if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, []string{tt.wantZone}, query["zone"], tt.name)
+			assert.Equal(t, []string{tt.wantFQDN}, query["fqdn"], tt.name)
+		}
+		netbox.Close()
+	}
+}
+
+func TestQueryRecordPaginated(t *testing.T) {
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "123456789"
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.org",
+			"active": "true",
+			"fqdn":   "mail1.example.org.",
+			"type":   "A",
+		}).Reply(200).BodyString(`{
+			"count": 2,
+			"next": "https://example.org/api/plugins/netbox-dns/records/?active=true&fqdn=mail1.example.org.&limit=1&offset=1&type=A&type=CNAME&zone=example.org",
+			"results": [
+			{
+				"type": "A",
+				"ttl": 8600,
+				"value": "192.168.0.1",
+				"absolute_value": "192.168.0.1",
+				"fqdn": "mail1.example.org."
+			}]
+		}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.org",
+			"active": "true",
+			"fqdn":   "mail1.example.org.",
+			"type":   "A",
+			"offset": "1",
+		}).Reply(200).BodyString(`{
+			"count": 2,
+			"next": null,
+			"results": [
+			{
+				"type": "A",
+				"ttl": 8600,
+				"value": "192.168.0.2",
+				"absolute_value": "192.168.0.2",
+				"fqdn": "mail1.example.org."
+			}]
+		}`)
+
+	// following all pages takes a single request from the budget
+	records, err := n.queryRecord(withBudget(context.Background(), 1), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	if assert.NoError(t, err) && assert.Len(t, records, 2) {
+		assert.Equal(t, "192.168.0.1", records[0].AbsoluteValue)
+		assert.Equal(t, "192.168.0.2", records[1].AbsoluteValue)
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestQueryRecordPaginatedForeignLink(t *testing.T) {
+	var tokens []string
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		if r.URL.Query().Get("offset") == "" {
+			// NetBox behind a TLS terminating proxy links to itself over http
+			_, _ = w.Write([]byte(`{"next": "http://netbox.internal:8080/api/plugins/netbox-dns/records/?fqdn=mail1.example.org.&offset=1", "results": [{"type": "A", "ttl": 8600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.org."}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"next": null, "results": [{"type": "A", "ttl": 8600, "value": "192.168.0.2", "absolute_value": "192.168.0.2", "fqdn": "mail1.example.org."}]}`))
+	}))
+	defer netbox.Close()
+
+	n := newNetbox()
+	n.Url = netbox.URL
+	n.Token = "mytoken"
+
+	// the next page is requested from the configured URL
+	records, err := n.queryRecord(context.Background(), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	if assert.NoError(t, err) {
+		assert.Len(t, records, 2)
+	}
+	assert.Equal(t, []string{"Token mytoken", "Token mytoken"}, tokens)
+}
+
+func TestQueryRecordPaginatedLoop(t *testing.T) {
+	var requests int
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"next": "https://example.org/api/plugins/netbox-dns/records/?fqdn=mail1.example.org.&offset=1", "results": []}`))
+	}))
+	defer netbox.Close()
+
+	n := newNetbox()
+	n.Url = netbox.URL
+	n.Token = "mytoken"
+
+	// a page linking to itself is not followed forever
+	_, err := n.queryRecord(context.Background(), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	assert.Error(t, err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestFollowPagesBounded(t *testing.T) {
+	var pages int
+	err := followPages("https://example.org/api/plugins/netbox-dns/records/", func(pageURL string) (string, error) {
+		pages++
+		return fmt.Sprintf("https://example.org/api/plugins/netbox-dns/records/?offset=%d", pages), nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, maxPages, pages)
+}
+
+func TestQueryRecordCoalesced(t *testing.T) {
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "123456789"
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	// only one slow upstream response is mocked, every further request would fail
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.org",
+			"active": "true",
+			"fqdn":   "mail1.example.org.",
+			"type":   "A",
+		}).Reply(200).Delay(200 * time.Millisecond).BodyString(`{
+			"results": [
+			{
+				"type": "A",
+				"ttl": 8600,
+				"value": "192.168.0.1",
+				"absolute_value": "192.168.0.1",
+				"fqdn": "mail1.example.org."
+			}]
+		}`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			records, err := n.queryRecord(context.Background(), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+			if assert.NoError(t, err) && assert.Len(t, records, 1) {
+				assert.Equal(t, "192.168.0.1", records[0].AbsoluteValue)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, gock.IsDone())
+}
+
+func TestQueryRecordSharedDetached(t *testing.T) {
+	var calls atomic.Int32
+	requested, release := make(chan struct{}), make(chan struct{})
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(requested)
+		}
+		<-release
+		_, _ = w.Write([]byte(`{"results": [{"type": "A", "ttl": 8600, "value": "192.168.0.1", "absolute_value": "192.168.0.1", "fqdn": "mail1.example.org."}]}`))
+	}))
+	defer netbox.Close()
+
+	n := newNetbox()
+	n.Url = netbox.URL
+	n.Token = "123456789"
+
+	// the first caller starts the shared request and gives up
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := n.queryRecord(first, "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+		firstErr <- err
+	}()
+	<-requested
+
+	// a caller with its budget exhausted does not join the shared request
+	exhausted := withBudget(context.Background(), 1)
+	spend(exhausted)
+	_, err := n.queryRecord(exhausted, "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	assert.ErrorIs(t, err, errBudgetExhausted)
+
+	// the others still get the result once the first caller gave up
+	secondErr := make(chan error)
+	go func() {
+		records, err := n.queryRecord(withBudget(context.Background(), 1), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+		if err == nil {
+			assert.Len(t, records, 1)
+		}
+		secondErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+	close(release)
+	assert.NoError(t, <-secondErr)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestQueryRecordSharedCanceled(t *testing.T) {
+	requested, aborted := make(chan struct{}), make(chan struct{})
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requested)
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer netbox.Close()
+
+	n := newNetbox()
+	n.Url = netbox.URL
+	n.Token = "123456789"
+
+	// the shared request is aborted once its only caller gave up
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-requested
+		cancel()
+	}()
+	_, err := n.queryRecord(ctx, "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	assert.ErrorIs(t, err, context.Canceled)
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Error("request against NetBox was not aborted")
+	}
+}
+
+func TestQueryRecordSharedShutdown(t *testing.T) {
+	requested, aborted := make(chan struct{}), make(chan struct{})
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requested)
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer netbox.Close()
+
+	n := newNetbox()
+	n.Url = netbox.URL
+	n.Token = "123456789"
+
+	// shutting down aborts the requests still waited for
+	go func() {
+		<-requested
+		n.cancelRequests()
+	}()
+	_, err := n.queryRecord(context.Background(), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	assert.Error(t, err)
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Error("request against NetBox was not aborted")
+	}
+}
+
+func TestQueryRecordNoClient(t *testing.T) {
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Client = nil
+
+	// a missing client fails the request instead of the shared call
+	_, err := n.queryRecord(context.Background(), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	assert.ErrorContains(t, err, "provided *http.Client was invalid")
+}
+
 func TestQueryZone(t *testing.T) {
 	n := newNetbox()
 	n.Url = "https://example.org"
@@ -316,6 +1385,8 @@ func TestQueryZone(t *testing.T) {
 		},
 	}
 
+	defer gock.Off() // Flush pending mocks after test execution
+
 	// set up mock responses
 	for _, tt := range tests {
 		gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
@@ -327,7 +1398,7 @@ func TestQueryZone(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		responses, err := n.queryZone(tt.zone)
+		responses, err := n.queryZone(context.Background(), tt.zone, "")
 		if tt.wantErr {
 			assert.Error(t, err, tt.name)
 		} else {
@@ -340,3 +1411,348 @@ func TestQueryZone(t *testing.T) {
 		}
 	}
 }
+
+func TestQueryZonePaginated(t *testing.T) {
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "123456789"
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
+		map[string]string{
+			"name":   "example.org",
+			"active": "true",
+		}).Reply(200).BodyString(`{
+			"count": 2,
+			"next": "https://example.org/api/plugins/netbox-dns/zones/?active=true&limit=1&name=example.org&offset=1",
+			"results": [
+			{
+				"name": "example.org",
+				"soa_ttl": 86400,
+				"soa_mname": {
+					"name": "ns1.example.org"
+				},
+				"soa_rname": "admin.example.org",
+				"soa_serial": 1742857987,
+				"soa_refresh": 43200,
+				"soa_retry": 7200,
+				"soa_expire": 2419200,
+				"soa_minimum": 3600
+			}]
+		}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
+		map[string]string{
+			"name":   "example.org",
+			"active": "true",
+			"offset": "1",
+		}).Reply(200).BodyString(`{
+			"count": 2,
+			"next": null,
+			"results": [
+			{
+				"name": "example.org",
+				"soa_ttl": 3600,
+				"soa_mname": {
+					"name": "ns2.example.org"
+				},
+				"soa_rname": "admin.example.org",
+				"soa_serial": 1742857988,
+				"soa_refresh": 43200,
+				"soa_retry": 7200,
+				"soa_expire": 2419200,
+				"soa_minimum": 3600
+			}]
+		}`)
+
+	zones, err := n.queryZone(context.Background(), "example.org.", "")
+	if assert.NoError(t, err) && assert.Len(t, zones, 2) {
+		assert.Equal(t, "ns1.example.org", zones[0].MName.Name)
+		assert.Equal(t, "ns2.example.org", zones[1].MName.Name)
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestQueryWithPrefixedURL(t *testing.T) {
+	n := newNetbox()
+	n.Url = "https://example.org/netbox/"
+	n.Token = "123456789"
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/netbox/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.org",
+			"active": "true",
+			"fqdn":   "mail1.example.org.",
+			"type":   "A",
+		}).Reply(200).BodyString(`{
+			"results": [
+			{
+				"type": "A",
+				"ttl": 8600,
+				"value": "192.168.0.1",
+				"absolute_value": "192.168.0.1",
+				"fqdn": "mail1.example.org."
+			}]
+		}`)
+	gock.New("https://example.org/netbox/api/plugins/netbox-dns/zones/").MatchParams(
+		map[string]string{
+			"name":   "example.org",
+			"active": "true",
+		}).Reply(200).BodyString(`{"results": [{"name": "example.org"}]}`)
+
+	records, err := n.queryRecord(context.Background(), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	zones, err := n.queryZone(context.Background(), "example.org.", "")
+	assert.NoError(t, err)
+	assert.Len(t, zones, 1)
+
+	assert.True(t, gock.IsDone())
+}
+
+func TestQueryRecordTenant(t *testing.T) {
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "123456789"
+	n.Tenant = "acme"
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "^example.org$",
+			"fqdn":   "^mail1.example.org.$",
+			"type":   "^A$",
+			"tenant": "^acme$",
+		}).Reply(200).BodyString(`{"results": []}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
+		map[string]string{
+			"name":   "^example.org$",
+			"tenant": "^acme$",
+		}).Reply(200).BodyString(`{"results": []}`)
+
+	records, err := n.queryRecord(context.Background(), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	zones, err := n.queryZone(context.Background(), "example.org.", "")
+	assert.NoError(t, err)
+	assert.Empty(t, zones)
+
+	assert.True(t, gock.IsDone())
+}
+
+func TestQueryIncludeInactive(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	for _, includeInactive := range []bool{false, true} {
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "123456789"
+		n.IncludeInactive = includeInactive
+
+		// the active filter is only sent unless inactive records are included
+		active := func(req *http.Request, _ *gock.Request) (bool, error) {
+			_, ok := req.URL.Query()["active"]
+			return ok != includeInactive, nil
+		}
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").AddMatcher(active).Times(2).Reply(200).BodyString(`{"results": []}`)
+		gock.New("https://example.org/api/plugins/netbox-dns/zones/").AddMatcher(active).Reply(200).BodyString(`{"results": []}`)
+
+		_, err := n.queryRecord(context.Background(), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+		assert.NoError(t, err)
+		_, err = n.queryZoneRecords(context.Background(), "example.org.", "")
+		assert.NoError(t, err)
+		_, err = n.queryZone(context.Background(), "example.org.", "")
+		assert.NoError(t, err)
+
+		assert.True(t, gock.IsDone(), "include_inactive %t", includeInactive)
+	}
+}
+
+func TestQueryRecordCanceled(t *testing.T) {
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "123456789"
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^mail1.example.org.$",
+		}).Reply(200).Delay(time.Second * 5).BodyString(`{"results": []}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*50, cancel)
+
+	start := time.Now()
+	_, err := n.queryRecord(ctx, "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestQueryPageSize(t *testing.T) {
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "123456789"
+	n.PageSize = 500
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":  "^example.org$",
+			"fqdn":  "^mail1.example.org.$",
+			"limit": "^500$",
+		}).Reply(200).BodyString(`{"results": []}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
+		map[string]string{
+			"name":  "^example.org$",
+			"limit": "^500$",
+		}).Reply(200).BodyString(`{"results": []}`)
+
+	_, err := n.queryRecord(context.Background(), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	assert.NoError(t, err)
+	_, err = n.queryZone(context.Background(), "example.org.", "")
+	assert.NoError(t, err)
+
+	assert.True(t, gock.IsDone())
+}
+
+func TestQueryGzip(t *testing.T) {
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "123456789"
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	compress := func(body string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write([]byte(body))
+		_ = zw.Close()
+		return buf.Bytes()
+	}
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^mail1.example.org.$",
+		}).MatchHeader("Accept-Encoding", "gzip").Reply(200).SetHeader(
+		"Content-Encoding", "gzip").Body(bytes.NewReader(compress(`{
+			"results": [
+			{
+				"type": "A",
+				"ttl": 8600,
+				"value": "192.168.0.1",
+				"absolute_value": "192.168.0.1",
+				"fqdn": "mail1.example.org."
+			}]
+		}`)))
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
+		map[string]string{
+			"name": "^example.org$",
+		}).MatchHeader("Accept-Encoding", "gzip").Reply(200).SetHeader(
+		"Content-Encoding", "gzip").Body(bytes.NewReader(compress(`{"results": [{"name": "example.org"}]}`)))
+	// plain responses are still decoded as is
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone": "^example.org$",
+			"fqdn": "^mail2.example.org.$",
+		}).Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 8600, "value": "192.168.0.2", "absolute_value": "192.168.0.2", "fqdn": "mail2.example.org."}]}`)
+
+	records, err := n.queryRecord(context.Background(), "example.org.", "", "mail1.example.org.", DNSQuerySetA)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "192.168.0.1", records[0].AbsoluteValue)
+	}
+
+	zones, err := n.queryZone(context.Background(), "example.org.", "")
+	assert.NoError(t, err)
+	if assert.Len(t, zones, 1) {
+		assert.Equal(t, "example.org", zones[0].Name)
+	}
+
+	records, err = n.queryRecord(context.Background(), "example.org.", "", "mail2.example.org.", DNSQuerySetA)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	assert.True(t, gock.IsDone())
+}
+
+func TestQueryRecordEscaped(t *testing.T) {
+	tests := []struct {
+		name     string
+		fqdn     string
+		querySet DNSQuerySet
+	}{
+		{
+			"SRV name with underscore labels",
+			"_ldap._tcp.dc._msdcs.example.org.",
+			DNSQuerySetSRV,
+		},
+		{
+			"name with plus and space",
+			"a+b c.example.org.",
+			DNSQuerySetA,
+		},
+	}
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	for _, tt := range tests {
+		n := newNetbox()
+		n.Url = "https://example.org"
+		n.Token = "123456789"
+
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+			map[string]string{
+				"zone":   "^example.org$",
+				"active": "^true$",
+				"fqdn":   "^" + regexp.QuoteMeta(tt.fqdn) + "$",
+			}).AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+			// the type filters are kept next to the escaped parameters
+			params, _ := url.ParseQuery(string(tt.querySet))
+			return slices.Equal(req.URL.Query()["type"], params["type"]), nil
+		}).Reply(200).BodyString(`{"results": []}`)
+
+		records, err := n.queryRecord(context.Background(), "example.org.", "", tt.fqdn, tt.querySet)
+		assert.NoError(t, err, tt.name)
+		assert.Empty(t, records, tt.name)
+		assert.True(t, gock.IsDone(), tt.name)
+	}
+}
+
+func BenchmarkQueryRecordDecode(b *testing.B) {
+	var body strings.Builder
+	body.WriteString(`{"next": null, "results": [`)
+	for i := 0; i < 100; i++ {
+		if i > 0 {
+			body.WriteString(",")
+		}
+		fmt.Fprintf(&body, `{"type": "A", "ttl": 3600, "value": "192.168.0.%d", "absolute_value": "192.168.0.%d", "fqdn": "host.example.org."}`, i, i)
+	}
+	body.WriteString(`]}`)
+
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body.String()))
+	}))
+	defer netbox.Close()
+
+	n := newNetbox()
+	n.Url = netbox.URL
+	n.Token = "123456789"
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		records, err := n.queryRecord(context.Background(), "example.org.", "", "host.example.org.", DNSQuerySetA)
+		if err != nil || len(records) != 100 {
+			b.Fatalf("unexpected result: %d records, %v", len(records), err)
+		}
+	}
+}
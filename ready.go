@@ -16,9 +16,15 @@
 package netbox
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	ot "github.com/opentracing/opentracing-go"
 )
 
 type status struct {
@@ -30,28 +36,171 @@ type statusApps struct {
 	DNSPlugin string `json:"netbox_dns"`
 }
 
-// Ready tests the connection to netbox and gathers version and capabilities
+// Ready reports whether NetBox was reachable at the last status check. Without
+// the background status check NetBox is probed on every call.
 func (n *Netbox) Ready() bool {
-	resp, err := get(n.Client, fmt.Sprintf("%s/api/status", n.Url), n.Token)
+	if !n.checking.Load() {
+		return n.probe()
+	}
+	return n.health.Load()
+}
+
+// probe runs the status check and records its result as health of NetBox
+func (n *Netbox) probe() bool {
+	ok := n.checkStatus()
+	n.health.Store(ok)
+	if ok {
+		healthy.Set(1)
+	} else {
+		healthy.Set(0)
+	}
+	return ok
+}
+
+// checkStatus tests the connection to netbox and gathers version and
+// capabilities. A reachable NetBox without the NetBox DNS plugin is ready as
+// well, it is answered from IPAM then. The check is traced as root span if the
+// trace plugin is enabled.
+func (n *Netbox) checkStatus() bool {
+	ctx := context.Background()
+	if span := n.startRootSpan("netbox " + endpointStatus); span != nil {
+		defer span.Finish()
+		span.SetTag("endpoint", endpointStatus)
+		ctx = ot.ContextWithSpan(ctx, span)
+	}
+
+	resp, err := n.get(ctx, endpointStatus, n.statusURL(), nil)
 	if err != nil {
-		log.Warning("HTTP request failed, check your configuration")
+		log.Warningf("NetBox is unreachable, check your configuration: %s", n.redact(err.Error()))
 		return false
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Warning(fmt.Sprintf("The server returned error code: %d", resp.StatusCode))
+		requestErrors.WithLabelValues(errorBadStatus).Inc()
+		log.Warning(fmt.Sprintf("NetBox is reachable, but its status returned error code: %d", resp.StatusCode))
 		return false
 	}
 
 	var s status
 	decoder := json.NewDecoder(resp.Body)
 	if err := decoder.Decode(&s); err != nil {
+		requestErrors.WithLabelValues(errorDecode).Inc()
 		log.Warning(fmt.Errorf("could not parse netbox status: %w", err))
 		return false
 	}
 
-	n.UsePlugin = s.Apps.DNSPlugin != ""
-	log.Infof("Netbox Version: %s, Netbox DNS Plugin Version: %s, Use Plugin: %t", s.Version, s.Apps.DNSPlugin, n.UsePlugin)
+	// an incompatible plugin is still used, but its API may fail in ways
+	// which are hard to tell otherwise
+	compatible := ""
+	if s.Apps.DNSPlugin != "" {
+		compatible = "true"
+		if !pluginCompatible(s.Apps.DNSPlugin) {
+			compatible = "false"
+			log.Warningf("NetBox DNS plugin version %s is not supported, expected %s", s.Apps.DNSPlugin, supportedPluginVersions)
+		}
+	}
+
+	// only the versions found last are exported
+	info.Reset()
+	info.WithLabelValues(s.Version, s.Apps.DNSPlugin, compatible).Set(1)
+
+	usePlugin := s.Apps.DNSPlugin != ""
+	switch n.Mode {
+	case ModePlugin:
+		if !usePlugin {
+			log.Warning("'mode plugin' is set, but the NetBox DNS plugin is not installed")
+		}
+		usePlugin = true
+	case ModeNative:
+		if usePlugin {
+			log.Warning("'mode native' is set, the installed NetBox DNS plugin is not used")
+		}
+		usePlugin = false
+	default:
+		if !usePlugin {
+			log.Info("NetBox is reachable, but the NetBox DNS plugin is not installed, answering from IPAM")
+		}
+	}
+	n.mu.Lock()
+	n.UsePlugin = usePlugin
+	n.mu.Unlock()
+	log.Infof("Netbox Version: %s, Netbox DNS Plugin Version: %s, Use Plugin: %t", s.Version, s.Apps.DNSPlugin, usePlugin)
 
 	return true
 }
+
+// supportedPluginVersions describes the versions of the NetBox DNS plugin the
+// API of records and zones is known to match
+const supportedPluginVersions = ">= 1.0.0, < 2.0.0"
+
+// pluginCompatible reports whether version is within supportedPluginVersions,
+// suffixes like -beta1 are ignored
+func pluginCompatible(version string) bool {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+ "); i >= 0 {
+		version = version[:i]
+	}
+	major, _, _ := strings.Cut(version, ".")
+	v, err := strconv.Atoi(major)
+	if err != nil {
+		return false
+	}
+	return v == 1
+}
+
+// statusURL returns the URL of the status endpoint, StatusPath is relative
+// to the NetBox URL and defaults to the status endpoint of the API
+func (n *Netbox) statusURL() string {
+	if n.StatusPath == "" {
+		return n.apiURL("status")
+	}
+	return strings.TrimRight(n.Url, "/") + n.StatusPath
+}
+
+// usePlugin reports whether the NetBox DNS plugin was detected by the last Ready
+func (n *Netbox) usePlugin() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.UsePlugin
+}
+
+// startStatusCheck re-runs the status check every StatusInterval until
+// stopStatusCheck is called, this way an installed or removed NetBox DNS plugin
+// is noticed. Ready reports the result of the last check meanwhile.
+func (n *Netbox) startStatusCheck() {
+	if n.StatusInterval <= 0 {
+		return
+	}
+	n.checking.Store(true)
+	n.stop = make(chan struct{})
+	n.stopped = make(chan struct{})
+	go func(stop, stopped chan struct{}) {
+		defer close(stopped)
+		ticker := time.NewTicker(n.StatusInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if n.probe() && n.AutoZones {
+					if err := n.refreshZones(context.Background()); err != nil {
+						log.Warningf("could not refresh zones: %s", err)
+					}
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(n.stop, n.stopped)
+}
+
+// stopStatusCheck stops the background status check and waits for it to return
+func (n *Netbox) stopStatusCheck() {
+	if n.stop == nil {
+		return
+	}
+	close(n.stop)
+	<-n.stopped
+	n.stop = nil
+	n.checking.Store(false)
+}
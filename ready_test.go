@@ -14,8 +14,16 @@
 package netbox
 
 import (
+	"bytes"
+	"errors"
+	golog "log"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"gopkg.in/h2non/gock.v1"
 )
@@ -30,20 +38,273 @@ func TestNetboxReady(t *testing.T) {
 		Version: "4.2.5-Docker-3.2.0",
 	})
 
-	nb := Netbox{Url: "https://example.org/api/status", Token: "s3kr3tt0ken", Client: &http.Client{}}
+	nb := Netbox{Url: "https://example.org", APIPrefix: defaultAPIPrefix, Token: "s3kr3tt0ken", Client: &http.Client{}}
 	ready := nb.Ready()
 	if !ready {
 		t.Errorf("Expected ready be %v, got %v", true, ready)
 	}
 }
 
+func TestNetboxReadyInfo(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/api/status").Reply(http.StatusOK).JSON(status{
+		Apps:    statusApps{DNSPlugin: "1.2.6"},
+		Version: "4.2.5-Docker-3.2.0",
+	})
+	gock.New("https://example.org/api/status").Reply(http.StatusOK).JSON(status{
+		Version: "4.3.0",
+	})
+
+	nb := Netbox{Url: "https://example.org", APIPrefix: defaultAPIPrefix, Token: "s3kr3tt0ken", Client: &http.Client{}}
+	nb.Ready()
+	labels := map[string]string{"netbox_version": "4.2.5-Docker-3.2.0", "plugin_version": "1.2.6", "plugin_compatible": "true"}
+	if got := metricValue(t, info, labels); got != 1 {
+		t.Errorf("Expected info with %v be %v, got %v", labels, 1, got)
+	}
+
+	// the versions found before are replaced
+	nb.Ready()
+	if got := metricValue(t, info, labels); got != 0 {
+		t.Errorf("Expected info with %v be %v, got %v", labels, 0, got)
+	}
+	labels = map[string]string{"netbox_version": "4.3.0", "plugin_version": "", "plugin_compatible": ""}
+	if got := metricValue(t, info, labels); got != 1 {
+		t.Errorf("Expected info with %v be %v, got %v", labels, 1, got)
+	}
+}
+
+func TestNetboxReadyIncompatiblePlugin(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/api/status").Reply(http.StatusOK).JSON(status{
+		Apps:    statusApps{DNSPlugin: "2.0.0-beta1"},
+		Version: "4.3.0",
+	})
+
+	// capture the warning
+	var buf bytes.Buffer
+	golog.SetOutput(&buf)
+	defer golog.SetOutput(os.Stderr)
+
+	// an incompatible plugin is still used
+	nb := Netbox{Url: "https://example.org", APIPrefix: defaultAPIPrefix, Token: "s3kr3tt0ken", Client: &http.Client{}}
+	if ready := nb.Ready(); !ready {
+		t.Errorf("Expected ready be %v, got %v", true, ready)
+	}
+	if usePlugin := nb.usePlugin(); !usePlugin {
+		t.Errorf("Expected use plugin be %v, got %v", true, usePlugin)
+	}
+	if !strings.Contains(buf.String(), "NetBox DNS plugin version 2.0.0-beta1 is not supported, expected "+supportedPluginVersions) {
+		t.Errorf("Expected warning about the plugin version, got %q", buf.String())
+	}
+	labels := map[string]string{"netbox_version": "4.3.0", "plugin_version": "2.0.0-beta1", "plugin_compatible": "false"}
+	if got := metricValue(t, info, labels); got != 1 {
+		t.Errorf("Expected info with %v be %v, got %v", labels, 1, got)
+	}
+}
+
+func TestPluginCompatible(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"1.0.0", true},
+		{"1.2.6", true},
+		{"v1.3.0-beta2", true},
+		{"0.22.8", false},
+		{"2.0.0", false},
+		{"unknown", false},
+	}
+	for _, tt := range tests {
+		if got := pluginCompatible(tt.version); got != tt.want {
+			t.Errorf("%s: Expected compatible be %v, got %v", tt.version, tt.want, got)
+		}
+	}
+}
+
+func TestNetboxReadyWithPrefix(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/netbox/v1/api/status").Reply(http.StatusOK).JSON(status{
+		Apps: statusApps{
+			DNSPlugin: "1.2.6",
+		},
+		Version: "4.2.5-Docker-3.2.0",
+	})
+
+	nb := Netbox{Url: "https://example.org/netbox/", APIPrefix: "/v1/api", Token: "s3kr3tt0ken", Client: &http.Client{}}
+	ready := nb.Ready()
+	if !ready {
+		t.Errorf("Expected ready be %v, got %v", true, ready)
+	}
+	if !gock.IsDone() {
+		t.Errorf("Expected status to be requested below the prefixed base URL")
+	}
+}
+
+func TestNetboxReadyWithStatusPath(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/health/status").Reply(http.StatusOK).JSON(status{
+		Apps: statusApps{
+			DNSPlugin: "1.2.6",
+		},
+		Version: "4.2.5-Docker-3.2.0",
+	})
+
+	nb := Netbox{Url: "https://example.org/", APIPrefix: defaultAPIPrefix, StatusPath: "/health/status", Token: "s3kr3tt0ken", Client: &http.Client{}}
+	ready := nb.Ready()
+	if !ready {
+		t.Errorf("Expected ready be %v, got %v", true, ready)
+	}
+	if !gock.IsDone() {
+		t.Errorf("Expected status to be requested at the configured status path")
+	}
+}
+
 func TestNetboxNotReady(t *testing.T) {
 	defer gock.Off() // Flush pending mocks after test execution
 	gock.New("https://example.org/api/status").Reply(403)
 
-	nb := Netbox{Url: "https://example.org/api/ipam/ip-addresses", Token: "s3kr3tt0ken", Client: &http.Client{}}
+	nb := Netbox{Url: "https://example.org", APIPrefix: defaultAPIPrefix, Token: "s3kr3tt0ken", Client: &http.Client{}}
 	not_ready := nb.Ready()
 	if not_ready {
 		t.Errorf("Expected ready to be %v, got %v", false, not_ready)
 	}
 }
+
+func TestNetboxReadyPlugin(t *testing.T) {
+	tests := []struct {
+		name      string
+		mock      func()
+		ready     bool
+		usePlugin bool
+	}{
+		{
+			"reachable without plugin",
+			func() {
+				gock.New("https://example.org/api/status").Reply(http.StatusOK).JSON(status{Version: "4.2.5"})
+			},
+			true,
+			false,
+		},
+		{
+			"reachable with plugin",
+			func() {
+				gock.New("https://example.org/api/status").Reply(http.StatusOK).JSON(status{
+					Apps:    statusApps{DNSPlugin: "1.2.6"},
+					Version: "4.2.5",
+				})
+			},
+			true,
+			true,
+		},
+		{
+			"unreachable",
+			func() {
+				gock.New("https://example.org/api/status").ReplyError(errors.New("connection refused"))
+			},
+			false,
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt.mock()
+
+		nb := Netbox{Url: "https://example.org", APIPrefix: defaultAPIPrefix, Token: "s3kr3tt0ken", Client: &http.Client{}}
+		if ready := nb.Ready(); ready != tt.ready {
+			t.Errorf("%s: Expected ready be %v, got %v", tt.name, tt.ready, ready)
+		}
+		if usePlugin := nb.usePlugin(); usePlugin != tt.usePlugin {
+			t.Errorf("%s: Expected use plugin be %v, got %v", tt.name, tt.usePlugin, usePlugin)
+		}
+		gock.Off()
+	}
+}
+
+func TestNetboxStatusCheck(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/api/status").Reply(http.StatusOK).JSON(status{
+		Apps: statusApps{
+			DNSPlugin: "1.2.6",
+		},
+		Version: "4.2.5-Docker-3.2.0",
+	})
+	// the plugin was removed afterwards
+	gock.New("https://example.org/api/status").Persist().Reply(http.StatusOK).JSON(status{
+		Version: "4.2.5-Docker-3.2.0",
+	})
+
+	nb := Netbox{Url: "https://example.org", APIPrefix: defaultAPIPrefix, Token: "s3kr3tt0ken", Client: &http.Client{}, StatusInterval: 10 * time.Millisecond}
+	if !nb.Ready() || !nb.usePlugin() {
+		t.Fatalf("Expected plugin to be used after initial status check")
+	}
+
+	nb.startStatusCheck()
+	defer nb.stopStatusCheck()
+
+	deadline := time.Now().Add(time.Second)
+	for nb.usePlugin() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if nb.usePlugin() {
+		t.Errorf("Expected plugin not to be used after periodic status check")
+	}
+}
+
+func TestNetboxHealth(t *testing.T) {
+	var up atomic.Bool
+	up.Store(true)
+	var probes atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"installed-apps": {"netbox_dns": "1.2.6"}, "netbox-version": "4.2.5"}`))
+	}))
+	defer ts.Close()
+
+	nb := Netbox{Url: ts.URL, APIPrefix: defaultAPIPrefix, Token: "s3kr3tt0ken", Client: &http.Client{}, StatusInterval: 10 * time.Millisecond}
+	if !nb.probe() {
+		t.Fatalf("Expected NetBox to be healthy after initial status check")
+	}
+
+	nb.startStatusCheck()
+	defer nb.stopStatusCheck()
+
+	// waitFor waits for Ready and the gauge to report health
+	waitFor := func(health bool) {
+		t.Helper()
+		want := 0.0
+		if health {
+			want = 1
+		}
+		deadline := time.Now().Add(time.Second)
+		for (nb.Ready() != health || metricValue(t, healthy, nil) != want) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if ready := nb.Ready(); ready != health {
+			t.Errorf("Expected ready be %v, got %v", health, ready)
+		}
+		if got := metricValue(t, healthy, nil); got != want {
+			t.Errorf("Expected healthy be %v, got %v", want, got)
+		}
+	}
+
+	up.Store(false)
+	waitFor(false)
+	up.Store(true)
+	waitFor(true)
+
+	// Ready reports the last status check instead of probing itself
+	nb.stopStatusCheck()
+	nb.checking.Store(true)
+	before := probes.Load()
+	for range 10 {
+		nb.Ready()
+	}
+	if got := probes.Load(); got != before {
+		t.Errorf("Expected Ready not to probe NetBox, got %d probes", got-before)
+	}
+	nb.checking.Store(false)
+}
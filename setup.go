@@ -16,22 +16,61 @@
 package netbox
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/dnstap"
 	"github.com/coredns/coredns/plugin/metrics"
 	ctls "github.com/coredns/coredns/plugin/pkg/tls"
+	"github.com/coredns/coredns/plugin/pkg/trace"
 
 	"github.com/coredns/caddy"
+	"github.com/miekg/dns"
+	"golang.org/x/time/rate"
 )
 
 var VERSION = "0.5.0"
 
+// tenantSlug matches the slugs NetBox accepts for tenants
+var tenantSlug = regexp.MustCompile(`^[-a-zA-Z0-9_]+$`)
+
+// customFieldName matches the names NetBox accepts for custom fields
+var customFieldName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// zoneLabel matches the labels of zones, made of letters, digits, hyphens and
+// underscores
+var zoneLabel = regexp.MustCompile(`^[-a-zA-Z0-9_]{1,63}$`)
+
+// vrfRD matches the route distinguishers NetBox accepts for VRFs
+var vrfRD = regexp.MustCompile(`^[-a-zA-Z0-9_.:]{1,21}$`)
+
 const (
-	defaultTTL     = time.Second * 3600 // 3600s
-	defaultTimeout = time.Second * 5    // 5s
+	defaultTTL              = time.Second * 3600 // 3600s
+	defaultTimeout          = time.Second * 5    // 5s
+	defaultMaxCNAMEDepth    = 8
+	defaultMaxUpstreamCalls = 16
+	defaultStatus           = time.Minute * 5 // 5m
+	defaultAPIPrefix        = "/api"
+	maxPageSize             = 1000 // the default MAX_PAGE_SIZE of NetBox
+
+	// connection pool of the transport used to query NetBox
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+	defaultIdleConnTimeout     = time.Second * 90 // 90s
 )
 
 // init registers this plugin.
@@ -60,8 +99,38 @@ func setup(c *caddy.Controller) error {
 			}
 			if x, ok := m.(*metrics.Metrics); ok {
 				x.MustRegister(requestCount)
+				x.MustRegister(requestDuration)
+				x.MustRegister(requestErrors)
+				x.MustRegister(inflightRequests)
+				x.MustRegister(queuedRequests)
+				x.MustRegister(cacheHits)
+				x.MustRegister(cacheMisses)
+				x.MustRegister(cacheEntries)
+				x.MustRegister(cacheStale)
+				x.MustRegister(cacheEvictions)
+				x.MustRegister(info)
+				x.MustRegister(healthy)
 			}
 		})
+		if taph := dnsserver.GetConfig(c).Handler("dnstap"); taph != nil {
+			if t, ok := taph.(*dnstap.Dnstap); ok {
+				n.setTapPlugin(t)
+			}
+		}
+		if traceh := dnsserver.GetConfig(c).Handler("trace"); traceh != nil {
+			if t, ok := traceh.(trace.Trace); ok {
+				n.tracer = t
+			}
+		}
+		n.cache.start(defaultCachePurge)
+		n.startStatusCheck()
+		return nil
+	})
+
+	c.OnShutdown(func() error {
+		n.cache.shutdown()
+		n.stopStatusCheck()
+		n.cancelRequests()
 		return nil
 	})
 
@@ -78,17 +147,98 @@ func setup(c *caddy.Controller) error {
 // newNetbox returns a basic *Netbox type with some defaults set
 func newNetbox() *Netbox {
 	return &Netbox{
-		TTL:   defaultTTL,
-		Zones: []string{"."},
+		APIPrefix:        defaultAPIPrefix,
+		TTL:              defaultTTL,
+		MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+		MaxUpstreamCalls: defaultMaxUpstreamCalls,
+		Zones:            []string{"."},
 		Client: &http.Client{
 			Timeout: defaultTimeout,
 		},
+		StatusInterval: defaultStatus,
+	}
+}
+
+// transport returns the custom transport of the client, creating one with a
+// tuned connection pool if the default transport is still in use
+func (n *Netbox) transport() *http.Transport {
+	if t, ok := n.Client.Transport.(*http.Transport); ok {
+		return t
+	}
+	t := newTransport()
+	t.MaxIdleConns = defaultMaxIdleConns
+	t.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	t.IdleConnTimeout = defaultIdleConnTimeout
+	n.Client.Transport = t
+	return t
+}
+
+// newTransport returns a clone of the default transport of the http package,
+// or a transport with the same settings if it has been wrapped, e.g. by
+// instrumentation
+func newTransport() *http.Transport {
+	if base, ok := http.DefaultTransport.(*http.Transport); ok {
+		return base.Clone()
+	}
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
 	}
 }
 
+// transports holds the transports of parsed configurations by their settings,
+// so reloading an unchanged configuration keeps the established connections
+var transports = struct {
+	sync.Mutex
+	m map[string]*http.Transport
+}{m: make(map[string]*http.Transport)}
+
+// sharedTransport returns the transport stored for settings, storing t if
+// there is none yet
+func sharedTransport(settings string, t *http.Transport) *http.Transport {
+	transports.Lock()
+	defer transports.Unlock()
+	if shared, ok := transports.m[settings]; ok {
+		return shared
+	}
+	transports.m[settings] = t
+	return t
+}
+
+// validZone reports whether zone is a domain name made of labels matching
+// zoneLabel, which rules out schemes, ports and whitespace
+func validZone(zone string) bool {
+	if zone == "." {
+		return true
+	}
+	if _, ok := dns.IsDomainName(zone); !ok {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(zone, "."), ".") {
+		if !zoneLabel.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
 // parseNetbox handles parsing of the plugins config
 func parseNetbox(c *caddy.Controller) (*Netbox, error) {
 	n := newNetbox()
+	tokenFile, tokenEnv := "", ""
+	// settings of the transport, tls and ca_file disable sharing it across
+	// reloads
+	var settings []string
+	customTLS := false
+	var caPool *x509.CertPool
 	i := 0
 	for c.Next() {
 		// ensure plugin is only included once in each block
@@ -98,7 +248,23 @@ func parseNetbox(c *caddy.Controller) (*Netbox, error) {
 		i++
 
 		// handle netbox [zones...]
-		zones := plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+		args := c.RemainingArgs()
+		for _, arg := range args {
+			// networks are expanded to their reverse zones
+			zones := []string{arg}
+			if _, _, err := net.ParseCIDR(arg); err == nil {
+				zones = plugin.Host(arg).NormalizeExact()
+			}
+			if len(zones) == 0 {
+				return n, c.Errf("invalid zone '%s'", arg)
+			}
+			for _, zone := range zones {
+				if !validZone(zone) {
+					return n, c.Errf("invalid zone '%s'", arg)
+				}
+			}
+		}
+		zones := plugin.OriginsFromArgsOrServerBlock(args, c.ServerBlockKeys)
 		if len(zones) > 0 {
 			n.Zones = zones
 		}
@@ -110,29 +276,182 @@ func parseNetbox(c *caddy.Controller) (*Netbox, error) {
 			case "fallthrough":
 				n.Fall.SetZonesFromArgs(c.RemainingArgs())
 
+			case "fallthrough_on":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case FallthroughErrors, FallthroughEmpty, FallthroughBoth:
+					n.FallthroughOn = c.Val()
+				default:
+					return n, c.Errf("'fallthrough_on' must be one of errors, empty and both, got '%s'", c.Val())
+				}
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
 			case "url":
 				if !c.NextArg() {
 					return nil, c.ArgErr()
 				}
 				n.Url = c.Val()
 
+			case "api_prefix":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				// normalize to a single leading and no trailing slash
+				n.APIPrefix = strings.TrimRight("/"+strings.TrimLeft(c.Val(), "/"), "/")
+
 			case "token":
 				if !c.NextArg() {
 					return n, c.ArgErr()
 				}
 				n.Token = c.Val()
 
+			case "token_file":
+				if !c.NextArg() {
+					return n, c.ArgErr()
+				}
+				tokenFile = c.Val()
+
+			case "token_env":
+				if !c.NextArg() {
+					return n, c.ArgErr()
+				}
+				tokenEnv = c.Val()
+
+			case "header":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return n, c.ArgErr()
+				}
+				if http.CanonicalHeaderKey(args[0]) == "Authorization" {
+					return n, c.Err("'header' can not set Authorization, use 'token' instead")
+				}
+				if n.Headers == nil {
+					n.Headers = make(http.Header)
+				}
+				n.Headers.Add(args[0], args[1])
+
+			case "user_agent":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n.UserAgent = c.Val()
+
 			case "tls":
 				args := c.RemainingArgs()
 				tlsConfig, err := ctls.NewTLSConfigFromArgs(args...)
 				if err != nil {
-					return n, err
+					return n, c.Errf("could not load 'tls' configuration: %s", err)
 				}
 
-				// add custom transport to client
-				n.Client.Transport = &http.Transport{
-					TLSClientConfig: tlsConfig,
+				// add tls configuration to client transport
+				n.transport().TLSClientConfig = tlsConfig
+				customTLS = true
+
+			case "ca_file":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				bundle, err := os.ReadFile(c.Val())
+				if err != nil {
+					return n, c.Errf("could not read 'ca_file': %s", err)
+				}
+				caPool = x509.NewCertPool()
+				if !caPool.AppendCertsFromPEM(bundle) {
+					return n, c.Errf("'ca_file' %s contains no valid certificates", c.Val())
 				}
+				customTLS = true
+
+			case "proxy":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				proxy, err := url.Parse(c.Val())
+				if err != nil {
+					return n, c.Errf("could not parse 'proxy': %s", err)
+				}
+				switch proxy.Scheme {
+				case "http", "https", "socks5":
+				default:
+					return n, c.Errf("'proxy' scheme must be http, https or socks5, got '%s'", proxy.Scheme)
+				}
+				if proxy.Host == "" {
+					return n, c.Errf("'proxy' must contain a host, got '%s'", c.Val())
+				}
+
+				// route requests of client through proxy
+				n.transport().Proxy = http.ProxyURL(proxy)
+				settings = append(settings, "proxy "+c.Val())
+
+			case "unix_socket":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				path := c.Val()
+				fi, err := os.Stat(path)
+				if err != nil {
+					return n, c.Errf("could not find 'unix_socket': %s", err)
+				}
+				if fi.Mode()&os.ModeSocket == 0 {
+					return n, c.Errf("'unix_socket' %s is not a socket", path)
+				}
+
+				// dial the socket instead of the host of url
+				n.transport().DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				}
+				settings = append(settings, "unix_socket "+path)
+
+			case "max_idle_conns", "max_idle_conns_per_host":
+				option := c.Val()
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conns, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return n, c.Errf("could not parse '%s': %s", option, err)
+				}
+				if conns <= 0 {
+					return n, c.Errf("'%s' must be positive, got %d", option, conns)
+				}
+				settings = append(settings, option+" "+c.Val())
+				if option == "max_idle_conns" {
+					n.transport().MaxIdleConns = conns
+				} else {
+					n.transport().MaxIdleConnsPerHost = conns
+				}
+
+			case "idle_conn_timeout":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				duration, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return n, c.Errf("could not parse 'idle_conn_timeout': %s", err)
+				}
+				if duration <= 0 {
+					return n, c.Errf("'idle_conn_timeout' must be positive, got %s", duration)
+				}
+				n.transport().IdleConnTimeout = duration
+				settings = append(settings, "idle_conn_timeout "+c.Val())
+
+			case "rate_limit":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				rps, err := strconv.ParseFloat(c.Val(), 64)
+				if err != nil {
+					return n, c.Errf("could not parse 'rate_limit': %s", err)
+				}
+				if rps <= 0 || math.IsInf(rps, 0) {
+					return n, c.Errf("'rate_limit' must be positive, got %s", c.Val())
+				}
+				// allow the requests of a whole second in a burst
+				n.limiter = rate.NewLimiter(rate.Limit(rps), max(1, int(math.Ceil(rps))))
 
 			case "ttl":
 				if !c.NextArg() {
@@ -144,6 +463,45 @@ func parseNetbox(c *caddy.Controller) (*Netbox, error) {
 				}
 				n.TTL = duration
 
+			case "min_ttl":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				duration, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return n, c.Errf("could not parse 'min_ttl': %s", err)
+				}
+				if duration < 0 {
+					return n, c.Errf("'min_ttl' must not be negative, got %s", duration)
+				}
+				n.MinTTL = duration
+
+			case "max_ttl":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				duration, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return n, c.Errf("could not parse 'max_ttl': %s", err)
+				}
+				if duration <= 0 {
+					return n, c.Errf("'max_ttl' must be positive, got %s", duration)
+				}
+				n.MaxTTL = duration
+
+			case "negative_ttl":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				duration, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return n, c.Errf("could not parse 'negative_ttl': %s", err)
+				}
+				if duration < 0 {
+					return n, c.Errf("'negative_ttl' must not be negative, got %s", duration)
+				}
+				n.NegativeTTL = duration
+
 			case "timeout":
 				if !c.NextArg() {
 					return nil, c.ArgErr()
@@ -154,20 +512,405 @@ func parseNetbox(c *caddy.Controller) (*Netbox, error) {
 				}
 				n.Client.Timeout = duration
 
+			case "query_timeout":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				duration, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return n, c.Errf("could not parse 'query_timeout': %s", err)
+				}
+				if duration <= 0 {
+					return n, c.Errf("'query_timeout' must be positive, got %s", duration)
+				}
+				n.QueryTimeout = duration
+
+			case "status_interval":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				duration, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return n, c.Errf("could not parse 'status_interval': %s", err)
+				}
+				n.StatusInterval = duration
+
+			case "status_path":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if !strings.HasPrefix(c.Val(), "/") {
+					return n, c.Errf("'status_path' must begin with '/', got '%s'", c.Val())
+				}
+				n.StatusPath = c.Val()
+
+			case "soa":
+				args := c.RemainingArgs()
+				if len(args) != 2 && len(args) != 6 {
+					return n, c.ArgErr()
+				}
+				n.SOA.MName = dns.Fqdn(args[0])
+				n.SOA.RName = dns.Fqdn(args[1])
+				if len(args) == 6 {
+					timers := []*time.Duration{&n.SOA.Refresh, &n.SOA.Retry, &n.SOA.Expire, &n.SOA.Minimum}
+					for i, arg := range args[2:] {
+						duration, err := time.ParseDuration(arg)
+						if err != nil {
+							return n, c.Errf("could not parse 'soa' timer: %s", err)
+						}
+						if duration <= 0 {
+							return n, c.Errf("'soa' timers must be positive, got %s", duration)
+						}
+						*timers[i] = duration
+					}
+				}
+
+			case "view":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return n, c.ArgErr()
+				}
+				view := View{Name: args[0]}
+				for _, arg := range args[1:] {
+					_, network, err := net.ParseCIDR(arg)
+					if err != nil {
+						return n, c.Errf("could not parse 'view' network: %s", err)
+					}
+					view.Networks = append(view.Networks, network)
+				}
+				if len(view.Networks) == 0 {
+					for _, v := range n.Views {
+						if len(v.Networks) == 0 {
+							return n, c.Errf("only one default 'view' may be set, got '%s' and '%s'", v.Name, view.Name)
+						}
+					}
+				}
+				n.Views = append(n.Views, view)
+
+			case "default_view":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return n, c.ArgErr()
+				}
+				if n.DefaultView != "" {
+					return n, c.Errf("only one 'default_view' may be set, got '%s' and '%s'", n.DefaultView, args[0])
+				}
+				n.DefaultView = args[0]
+
+			case "acl":
+				args := c.RemainingArgs()
+				if len(args) < 2 {
+					return n, c.ArgErr()
+				}
+				var rule ACLRule
+				switch args[0] {
+				case "allow":
+					rule.Allow = true
+				case "deny":
+				default:
+					return n, c.Errf("'acl' action must be allow or deny, got '%s'", args[0])
+				}
+				for _, arg := range args[1:] {
+					network, err := parseNetwork(arg)
+					if err != nil {
+						return n, c.Errf("could not parse 'acl' network: %s", err)
+					}
+					rule.Networks = append(rule.Networks, network)
+				}
+				n.ACL = append(n.ACL, rule)
+
+			case "allow_transfer":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return n, c.ArgErr()
+				}
+				for _, arg := range args {
+					network, err := parseNetwork(arg)
+					if err != nil {
+						return n, c.Errf("could not parse 'allow_transfer' network: %s", err)
+					}
+					n.AllowTransfer = append(n.AllowTransfer, network)
+				}
+
+			case "trust_ecs":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return n, c.ArgErr()
+				}
+				for _, arg := range args {
+					network, err := parseNetwork(arg)
+					if err != nil {
+						return n, c.Errf("could not parse 'trust_ecs' network: %s", err)
+					}
+					n.TrustECS = append(n.TrustECS, network)
+				}
+
+			case "tenant":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if !tenantSlug.MatchString(c.Val()) {
+					return n, c.Errf("invalid 'tenant' slug '%s'", c.Val())
+				}
+				n.Tenant = c.Val()
+
+			case "vrf":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if id, err := strconv.Atoi(c.Val()); err == nil {
+					if id <= 0 {
+						return n, c.Errf("'vrf' ID must be positive, got %d", id)
+					}
+				} else if !vrfRD.MatchString(c.Val()) {
+					return n, c.Errf("invalid 'vrf' route distinguisher '%s'", c.Val())
+				}
+				n.VRF = c.Val()
+
+			case "flatten_cname":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n.FlattenCNAME = true
+
+			case "round_robin":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n.RoundRobin = true
+
+			case "dnssec":
+				n.DNSSEC = true
+				for c.NextArg() {
+					key, err := parseKeyFile(c.Val())
+					if err != nil {
+						return n, c.Errf("could not read 'dnssec' key %s: %s", c.Val(), err)
+					}
+					n.keys = append(n.keys, key)
+				}
+
+			case "include_inactive":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n.IncludeInactive = true
+
+			case "log_queries":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n.LogQueries = true
+
+			case "synthesize_ptr":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n.SynthesizePTR = true
+
+			case "mode":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case ModeAuto, ModePlugin, ModeNative:
+					n.Mode = c.Val()
+				default:
+					return n, c.Errf("'mode' must be one of plugin, native and auto, got '%s'", c.Val())
+				}
+
+			case "autozones":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n.AutoZones = true
+
+			case "refuse_outside_zones":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n.RefuseOutsideZones = true
+
+			case "ttl_custom_field", "alias_custom_field", "txt_custom_field":
+				option := c.Val()
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if !customFieldName.MatchString(c.Val()) {
+					return n, c.Errf("invalid '%s' name '%s'", option, c.Val())
+				}
+				switch option {
+				case "ttl_custom_field":
+					n.TTLCustomField = c.Val()
+				case "alias_custom_field":
+					n.AliasCustomField = c.Val()
+				default:
+					n.TXTCustomField = c.Val()
+				}
+
+			case "page_size":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				size, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return n, c.Errf("could not parse 'page_size': %s", err)
+				}
+				if size <= 0 {
+					return n, c.Errf("'page_size' must be positive, got %d", size)
+				}
+				if size > maxPageSize {
+					log.Warningf("'page_size' %d exceeds the maximum, using %d", size, maxPageSize)
+					size = maxPageSize
+				}
+				n.PageSize = size
+
+			case "max_cname_depth":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				depth, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return n, c.Errf("could not parse 'max_cname_depth': %s", err)
+				}
+				if depth <= 0 {
+					return n, c.Errf("'max_cname_depth' must be positive, got %d", depth)
+				}
+				n.MaxCNAMEDepth = depth
+
+			case "max_upstream_calls":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				calls, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return n, c.Errf("could not parse 'max_upstream_calls': %s", err)
+				}
+				if calls <= 0 {
+					return n, c.Errf("'max_upstream_calls' must be positive, got %d", calls)
+				}
+				n.MaxUpstreamCalls = calls
+
+			case "cache":
+				size := defaultCacheSize
+				if c.NextArg() {
+					var err error
+					size, err = strconv.Atoi(c.Val())
+					if err != nil {
+						return n, c.Errf("could not parse 'cache': %s", err)
+					}
+					if size <= 0 {
+						return n, c.Errf("'cache' max entries must be positive, got %d", size)
+					}
+				}
+				n.cache = newCache(size)
+
+			case "serve_stale":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				duration, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return n, c.Errf("could not parse 'serve_stale': %s", err)
+				}
+				if duration <= 0 {
+					return n, c.Errf("'serve_stale' must be positive, got %s", duration)
+				}
+				n.ServeStale = duration
+
 			default:
 				return nil, c.Errf("unknown property '%s'", c.Val())
 			}
 		}
 	}
 
+	// stale answers are served from the response cache
+	if n.ServeStale > 0 {
+		if n.cache == nil {
+			return nil, c.Err("'serve_stale' requires 'cache'")
+		}
+		n.cache.stale = n.ServeStale
+	}
+
+	// a TTL can not be raised above the cap
+	if n.MaxTTL > 0 && n.MinTTL > n.MaxTTL {
+		return nil, c.Errf("'min_ttl' %s is larger than 'max_ttl' %s", n.MinTTL, n.MaxTTL)
+	}
+
+	// token, token_file and token_env are mutually exclusive
+	if (n.Token != "" && tokenFile != "") || (n.Token != "" && tokenEnv != "") || (tokenFile != "" && tokenEnv != "") {
+		return nil, c.Err("only one of 'token', 'token_file' and 'token_env' may be set")
+	}
+
+	// read token from file
+	if tokenFile != "" {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, c.Errf("could not read 'token_file': %s", err)
+		}
+		n.Token = strings.TrimRightFunc(string(token), unicode.IsSpace)
+	}
+
+	// read token from environment
+	if tokenEnv != "" {
+		n.Token = os.Getenv(tokenEnv)
+		if n.Token == "" {
+			return nil, c.Errf("environment variable '%s' of 'token_env' is unset or empty", tokenEnv)
+		}
+	}
+
+	// trust the CAs of ca_file instead of the system ones, a tls configuration
+	// is kept otherwise
+	if caPool != nil {
+		t := n.transport()
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.RootCAs = caPool
+	}
+
+	// tune the connection pool, a reload re-reads the token but keeps the
+	// connections of a transport with unchanged settings, certificates of tls
+	// may have changed though
+	n.transport()
+	if !customTLS {
+		n.Client.Transport = sharedTransport(strings.Join(settings, "\n"), n.transport())
+	}
+
+	// an attempt can not take longer than the request
+	if n.Client.Timeout > 0 && n.QueryTimeout > n.Client.Timeout {
+		return n, c.Errf("'query_timeout' %s exceeds 'timeout' %s", n.QueryTimeout, n.Client.Timeout)
+	}
+
 	// fail if url or token are not set
 	if n.Url == "" || n.Token == "" {
 		return nil, c.Err("Invalid config")
 	}
 
-	if !n.Ready() {
+	if !n.probe() {
 		return nil, c.Err("Netbox not reachable")
 	}
 
+	if n.AutoZones {
+		if !n.usePlugin() {
+			return nil, c.Err("'autozones' requires the NetBox DNS plugin")
+		}
+		if err := n.refreshZones(context.Background()); err != nil {
+			return nil, c.Errf("could not discover zones: %s", err)
+		}
+	}
+
 	return n, nil
 }
+
+// parseNetwork parses s in CIDR notation, a single address is turned into a
+// network holding just that address
+func parseNetwork(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	return network, err
+}
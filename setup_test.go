@@ -16,8 +16,24 @@
 package netbox
 
 import (
-	//"fmt"
+	"container/list"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -27,7 +43,7 @@ import (
 
 	// ctls "github.com/coredns/coredns/plugin/pkg/tls"
 	"github.com/stretchr/testify/assert"
-	"gopkg.in/h2non/gock.v1"
+	"golang.org/x/time/rate"
 )
 
 // TestParseNetbox tests the various things that should be parsed by setup.
@@ -50,15 +66,19 @@ func TestParseNetbox(t *testing.T) {
 			"netbox {\nurl http://example.org\ntoken foobar\n}\n",
 			false,
 			&Netbox{
-				Url:   "http://example.org",
-				Token: "foobar",
-				TTL:   defaultTTL,
-				Next:  plugin.Handler(nil),
-				Zones: []string{"."},
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
 				Client: &http.Client{
 					Timeout: defaultTimeout,
 				},
-				UsePlugin: true,
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
 			},
 		},
 		{
@@ -72,15 +92,19 @@ func TestParseNetbox(t *testing.T) {
 			"netbox example.org {\nurl http://example.org\ntoken foobar\n}\n",
 			false,
 			&Netbox{
-				Url:   "http://example.org",
-				Token: "foobar",
-				TTL:   defaultTTL,
-				Next:  plugin.Handler(nil),
-				Zones: []string{"example.org."},
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"example.org."},
 				Client: &http.Client{
 					Timeout: defaultTimeout,
 				},
-				UsePlugin: true,
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
 			},
 		},
 		{
@@ -88,15 +112,161 @@ func TestParseNetbox(t *testing.T) {
 			"netbox example.org example.net {\nurl http://example.org\ntoken foobar\n}\n",
 			false,
 			&Netbox{
-				Url:   "http://example.org",
-				Token: "foobar",
-				TTL:   defaultTTL,
-				Next:  plugin.Handler(nil),
-				Zones: []string{"example.org.", "example.net."},
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"example.org.", "example.net."},
 				Client: &http.Client{
 					Timeout: defaultTimeout,
 				},
-				UsePlugin: true,
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"valid config with zone in upper case",
+			"netbox Example.ORG {\nurl http://example.org\ntoken foobar\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"example.org."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with invalid zone",
+			"netbox exmaple .org {\nurl http://example.org\ntoken foobar\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with zone with empty label",
+			"netbox example..org {\nurl http://example.org\ntoken foobar\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with zone with whitespace",
+			"netbox \"exa mple.org\" {\nurl http://example.org\ntoken foobar\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with zone with scheme",
+			"netbox http://example.org {\nurl http://example.org\ntoken foobar\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with zone with port",
+			"netbox example.org:53 {\nurl http://example.org\ntoken foobar\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with zone with network",
+			"netbox 10.0.0.0/8 {\nurl http://example.org\ntoken foobar\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"10.in-addr.arpa."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with zone with network off the octet boundary",
+			"netbox 10.0.0.0/15 {\nurl http://example.org\ntoken foobar\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"0.10.in-addr.arpa.", "1.10.in-addr.arpa."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with zone with IPv6 network",
+			"netbox 2001:db8::/32 {\nurl http://example.org\ntoken foobar\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"8.b.d.0.1.0.0.2.ip6.arpa."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with zone with network and port",
+			"netbox 10.0.0.0/8:53 {\nurl http://example.org\ntoken foobar\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with zone with invalid character",
+			"netbox exa$mple.org {\nurl http://example.org\ntoken foobar\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with zone with underscore",
+			"netbox _msdcs.example.org {\nurl http://example.org\ntoken foobar\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"_msdcs.example.org."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
 			},
 		},
 		{
@@ -116,15 +286,19 @@ func TestParseNetbox(t *testing.T) {
 			"netbox {\nurl http://example.org\ntoken foobar\nttl 1800s\n}\n",
 			false,
 			&Netbox{
-				Url:   "http://example.org",
-				Token: "foobar",
-				TTL:   time.Second * 1800,
-				Next:  plugin.Handler(nil),
-				Zones: []string{"."},
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              time.Second * 1800,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
 				Client: &http.Client{
 					Timeout: defaultTimeout,
 				},
-				UsePlugin: true,
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
 			},
 		},
 		{
@@ -133,20 +307,157 @@ func TestParseNetbox(t *testing.T) {
 			true,
 			nil,
 		},
+		{
+			"config with min_ttl",
+			"netbox {\nurl http://example.org\ntoken foobar\nmin_ttl 30s\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MinTTL:           time.Second * 30,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with invalid min_ttl",
+			"netbox {\nurl http://example.org\ntoken foobar\nmin_ttl -1s\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with max_ttl",
+			"netbox {\nurl http://example.org\ntoken foobar\nmin_ttl 30s\nmax_ttl 5m\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MinTTL:           time.Second * 30,
+				MaxTTL:           time.Minute * 5,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with invalid max_ttl",
+			"netbox {\nurl http://example.org\ntoken foobar\nmax_ttl 0s\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with min_ttl above max_ttl",
+			"netbox {\nurl http://example.org\ntoken foobar\nmin_ttl 10m\nmax_ttl 5m\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with negative_ttl",
+			"netbox {\nurl http://example.org\ntoken foobar\nnegative_ttl 60s\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				NegativeTTL:      time.Second * 60,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with invalid negative_ttl",
+			"netbox {\nurl http://example.org\ntoken foobar\nnegative_ttl INVALID\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with negative negative_ttl",
+			"netbox {\nurl http://example.org\ntoken foobar\nnegative_ttl -5s\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with query_timeout",
+			"netbox {\nurl http://example.org\ntoken foobar\nquery_timeout 2s\ntimeout 4s\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: 4 * time.Second,
+				},
+				StatusInterval: defaultStatus,
+				QueryTimeout:   2 * time.Second,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with query_timeout exceeding timeout",
+			"netbox {\nurl http://example.org\ntoken foobar\nquery_timeout 6s\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with zero query_timeout",
+			"netbox {\nurl http://example.org\ntoken foobar\nquery_timeout 0s\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with invalid query_timeout",
+			"netbox {\nurl http://example.org\ntoken foobar\nquery_timeout soon\n}\n",
+			true,
+			nil,
+		},
 		{
 			"config with timeout",
 			"netbox {\nurl http://example.org\ntoken foobar\ntimeout 2s\n}\n",
 			false,
 			&Netbox{
-				Url:   "http://example.org",
-				Token: "foobar",
-				TTL:   defaultTTL,
-				Next:  plugin.Handler(nil),
-				Zones: []string{"."},
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
 				Client: &http.Client{
 					Timeout: time.Second * 2,
 				},
-				UsePlugin: true,
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
 			},
 		},
 		{
@@ -156,163 +467,1736 @@ func TestParseNetbox(t *testing.T) {
 			nil,
 		},
 		{
-			"config with fallthrough (all)",
-			"netbox {\nurl http://example.org\ntoken foobar\nfallthrough\n}\n",
+			"config with cache",
+			"netbox {\nurl http://example.org\ntoken foobar\ncache\n}\n",
 			false,
 			&Netbox{
-				Url:   "http://example.org",
-				Token: "foobar",
-				TTL:   defaultTTL,
-				Next:  plugin.Handler(nil),
-				Zones: []string{"."},
-				Fall:  fall.F{Zones: []string{"."}},
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
 				Client: &http.Client{
 					Timeout: defaultTimeout,
 				},
-				UsePlugin: true,
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+				cache:          newCache(defaultCacheSize),
 			},
 		},
 		{
-			"config with fallthrough (one domain)",
-			"netbox {\nurl http://example.org\ntoken foobar\nfallthrough example.org\n}\n",
+			"config with cache max entries",
+			"netbox {\nurl http://example.org\ntoken foobar\ncache 100\n}\n",
 			false,
 			&Netbox{
-				Url:   "http://example.org",
-				Token: "foobar",
-				TTL:   defaultTTL,
-				Next:  plugin.Handler(nil),
-				Zones: []string{"."},
-				Fall:  fall.F{Zones: []string{"example.org."}},
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
 				Client: &http.Client{
 					Timeout: defaultTimeout,
 				},
-				UsePlugin: true,
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+				cache:          newCache(100),
 			},
 		},
 		{
-			"config with fallthrough (multiple domains)",
-			"netbox {\nurl http://example.org\ntoken foobar\nfallthrough example.org example.net\n}\n",
+			"config with invalid cache max entries",
+			"netbox {\nurl http://example.org\ntoken foobar\ncache -1\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with serve_stale",
+			"netbox {\nurl http://example.org\ntoken foobar\nserve_stale 1h\ncache\n}\n",
 			false,
 			&Netbox{
-				Url:   "http://example.org",
-				Token: "foobar",
-				TTL:   defaultTTL,
-				Next:  plugin.Handler(nil),
-				Zones: []string{"."},
-				Fall:  fall.F{Zones: []string{"example.org.", "example.net."}},
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
 				Client: &http.Client{
 					Timeout: defaultTimeout,
 				},
-				UsePlugin: true,
+				StatusInterval: defaultStatus,
+				ServeStale:     time.Hour,
+				UsePlugin:      true,
+				cache:          &cache{entries: map[cacheKey]*list.Element{}, lru: list.New(), maxEntries: defaultCacheSize, stale: time.Hour},
 			},
 		},
 		{
-			"config with https",
-			"netbox {\nurl https://example.org\ntoken foobar\n}\n",
+			"config with serve_stale but no cache",
+			"netbox {\nurl http://example.org\ntoken foobar\nserve_stale 1h\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with invalid serve_stale",
+			"netbox {\nurl http://example.org\ntoken foobar\ncache\nserve_stale 0s\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with status_interval",
+			"netbox {\nurl http://example.org\ntoken foobar\nstatus_interval 1m\n}\n",
 			false,
 			&Netbox{
-				Url:   "https://example.org",
-				Token: "foobar",
-				TTL:   defaultTTL,
-				Next:  plugin.Handler(nil),
-				Zones: []string{"."},
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
 				Client: &http.Client{
 					Timeout: defaultTimeout,
 				},
-				UsePlugin: true,
+				StatusInterval: time.Minute,
+				UsePlugin:      true,
 			},
 		},
-		//! No clue why this test fails....
-		// {
-		// 	"config with https and tls (no options)",
-		// 	"netbox {\nurl https://example.org\ntoken foobar\ntls\n}\n",
-		// 	false,
-		// 	&Netbox{
-		// 		Url:   "https://example.org",
-		// 		Token: "foobar",
-		// 		TTL:   defaultTTL,
-		// 		Next:  plugin.Handler(nil),
-		// 		Zones: []string{"."},
-		// 		Client: &http.Client{
-		// 			Timeout: defaultTimeout,
-		// 			Transport: &http.Transport{
-		// 				TLSClientConfig: defaultTLSConfig,
-		// 			},
-		// 		},
-		// 		UsePlugin: true,
-		// 	},
-		// },
 		{
-			"config with https and tls (invalid config)",
-			"netbox {\nurl https://example.org\ntoken foobar\ntls testing/missing.crt\n}\n",
+			"config with invalid status_interval",
+			"netbox {\nurl http://example.org\ntoken foobar\nstatus_interval often\n}\n",
 			true,
 			nil,
 		},
-	}
-
-	for range tests {
-		gock.New("http://example.org/api/status").Reply(200).BodyString(`
 		{
-			"django-version": "5.1.7",
-			"installed-apps": {
-				"django_filters": "25.1",
-				"django_prometheus": "2.3.1",
-				"django_rq": "3.0.0",
-				"django_tables2": "2.7.5",
-				"drf_spectacular": "0.28.0",
-				"drf_spectacular_sidecar": "2025.3.1",
-				"mptt": "0.16.0",
-				"netbox_dns": "1.2.6",
-				"rest_framework": "3.15.2",
-				"social_django": "5.4.3",
-				"taggit": "6.1.0",
-				"timezone_field": "7.1"
-			},
-			"netbox-version": "4.2.5-Docker-3.2.0",
-			"plugins": {
-				"netbox_dns": "1.2.6"
+			"config with status_path",
+			"netbox {\nurl http://example.org\ntoken foobar\nstatus_path /api/status/\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				StatusPath:     "/api/status/",
+				UsePlugin:      true,
 			},
-			"python-version": "3.12.3",
-			"rq-workers-running": 1
-		}
-	`)
-
-		gock.New("https://example.org/api/status").Reply(200).BodyString(`
+		},
 		{
-			"django-version": "5.1.7",
-			"installed-apps": {
-				"django_filters": "25.1",
-				"django_prometheus": "2.3.1",
-				"django_rq": "3.0.0",
-				"django_tables2": "2.7.5",
-				"drf_spectacular": "0.28.0",
-				"drf_spectacular_sidecar": "2025.3.1",
-				"mptt": "0.16.0",
-				"netbox_dns": "1.2.6",
-				"rest_framework": "3.15.2",
-				"social_django": "5.4.3",
-				"taggit": "6.1.0",
-				"timezone_field": "7.1"
+			"config with relative status_path",
+			"netbox {\nurl http://example.org\ntoken foobar\nstatus_path api/status\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with soa",
+			"netbox {\nurl http://example.org\ntoken foobar\nsoa ns1.example.org admin.example.org\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				SOA: SOAConfig{
+					MName: "ns1.example.org.",
+					RName: "admin.example.org.",
+				},
+				UsePlugin: true,
 			},
-			"netbox-version": "4.2.5-Docker-3.2.0",
-			"plugins": {
-				"netbox_dns": "1.2.6"
+		},
+		{
+			"config with soa and timers",
+			"netbox {\nurl http://example.org\ntoken foobar\nsoa ns1.example.org. admin.example.org. 1h 10m 168h 1m\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				SOA: SOAConfig{
+					MName:   "ns1.example.org.",
+					RName:   "admin.example.org.",
+					Refresh: time.Hour,
+					Retry:   time.Minute * 10,
+					Expire:  time.Hour * 24 * 7,
+					Minimum: time.Minute,
+				},
+				UsePlugin: true,
 			},
-			"python-version": "3.12.3",
-			"rq-workers-running": 1
-		}
-	`)
-	}
-
-	// run tests
-	for _, tt := range tests {
-		c := caddy.NewTestController("dns", tt.input)
+		},
+		{
+			"config with soa and missing timers",
+			"netbox {\nurl http://example.org\ntoken foobar\nsoa ns1.example.org admin.example.org 1h\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with soa and invalid timer",
+			"netbox {\nurl http://example.org\ntoken foobar\nsoa ns1.example.org admin.example.org 1h 10m 1d 1m\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with views",
+			"netbox {\nurl http://example.org\ntoken foobar\nview internal 10.0.0.0/8 fd00::/8\nview external\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				Views: []View{
+					{Name: "internal", Networks: []*net.IPNet{
+						{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+						{IP: net.ParseIP("fd00::"), Mask: net.CIDRMask(8, 128)},
+					}},
+					{Name: "external"},
+				},
+				UsePlugin: true,
+			},
+		},
+		{
+			"config with view and invalid network",
+			"netbox {\nurl http://example.org\ntoken foobar\nview internal 10.0.0.0/33\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with two default views",
+			"netbox {\nurl http://example.org\ntoken foobar\nview internal\nview external\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with default_view",
+			"netbox {\nurl http://example.org\ntoken foobar\nview internal 10.0.0.0/8\nview external\ndefault_view internal\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				Views: []View{
+					{Name: "internal", Networks: []*net.IPNet{
+						{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+					}},
+					{Name: "external"},
+				},
+				DefaultView: "internal",
+				UsePlugin:   true,
+			},
+		},
+		{
+			"config with two default_view",
+			"netbox {\nurl http://example.org\ntoken foobar\ndefault_view internal\ndefault_view external\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with default_view but no name",
+			"netbox {\nurl http://example.org\ntoken foobar\ndefault_view\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with view but no name",
+			"netbox {\nurl http://example.org\ntoken foobar\nview\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with allow_transfer",
+			"netbox {\nurl http://example.org\ntoken foobar\nallow_transfer 10.0.0.0/8 192.168.0.1 2001:db8::1\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				AllowTransfer: []*net.IPNet{
+					{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+					{IP: net.IP{192, 168, 0, 1}, Mask: net.CIDRMask(32, 32)},
+					{IP: net.ParseIP("2001:db8::1"), Mask: net.CIDRMask(128, 128)},
+				},
+				UsePlugin: true,
+			},
+		},
+		{
+			"config with acl",
+			"netbox {\nurl http://example.org\ntoken foobar\nacl allow 10.1.0.0/16 192.168.0.1\nacl deny 10.0.0.0/8\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				ACL: []ACLRule{
+					{Allow: true, Networks: []*net.IPNet{
+						{IP: net.IP{10, 1, 0, 0}, Mask: net.CIDRMask(16, 32)},
+						{IP: net.IP{192, 168, 0, 1}, Mask: net.CIDRMask(32, 32)},
+					}},
+					{Allow: false, Networks: []*net.IPNet{
+						{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+					}},
+				},
+				UsePlugin: true,
+			},
+		},
+		{
+			"config with acl and invalid action",
+			"netbox {\nurl http://example.org\ntoken foobar\nacl block 10.0.0.0/8\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with acl and invalid network",
+			"netbox {\nurl http://example.org\ntoken foobar\nacl deny 10.0.0.0/33\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with acl without networks",
+			"netbox {\nurl http://example.org\ntoken foobar\nacl deny\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with trust_ecs",
+			"netbox {\nurl http://example.org\ntoken foobar\ntrust_ecs 10.0.0.0/8 2001:db8::53\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				TrustECS: []*net.IPNet{
+					{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+					{IP: net.ParseIP("2001:db8::53"), Mask: net.CIDRMask(128, 128)},
+				},
+				UsePlugin: true,
+			},
+		},
+		{
+			"config with trust_ecs and invalid network",
+			"netbox {\nurl http://example.org\ntoken foobar\ntrust_ecs 10.0.0.0/33\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with trust_ecs but no network",
+			"netbox {\nurl http://example.org\ntoken foobar\ntrust_ecs\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with allow_transfer and invalid network",
+			"netbox {\nurl http://example.org\ntoken foobar\nallow_transfer 10.0.0.0/33\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with allow_transfer but no network",
+			"netbox {\nurl http://example.org\ntoken foobar\nallow_transfer\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with user_agent",
+			"netbox {\nurl http://example.org\ntoken foobar\nuser_agent dns-resolver/1.0\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UserAgent:      "dns-resolver/1.0",
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with user_agent but no value",
+			"netbox {\nurl http://example.org\ntoken foobar\nuser_agent\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with invalid rate_limit",
+			"netbox {\nurl http://example.org\ntoken foobar\nrate_limit fast\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with zero rate_limit",
+			"netbox {\nurl http://example.org\ntoken foobar\nrate_limit 0\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with tenant",
+			"netbox {\nurl http://example.org\ntoken foobar\ntenant acme-corp\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				Tenant:         "acme-corp",
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with invalid tenant slug",
+			"netbox {\nurl http://example.org\ntoken foobar\ntenant acme/corp\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with tenant but no slug",
+			"netbox {\nurl http://example.org\ntoken foobar\ntenant\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with vrf ID",
+			"netbox {\nurl http://example.org\ntoken foobar\nvrf 3\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				VRF:            "3",
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with vrf route distinguisher",
+			"netbox {\nurl http://example.org\ntoken foobar\nvrf 65000:100\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				VRF:            "65000:100",
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with negative vrf ID",
+			"netbox {\nurl http://example.org\ntoken foobar\nvrf -1\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with invalid vrf route distinguisher",
+			"netbox {\nurl http://example.org\ntoken foobar\nvrf my/vrf\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with vrf but no value",
+			"netbox {\nurl http://example.org\ntoken foobar\nvrf\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with flatten_cname",
+			"netbox {\nurl http://example.org\ntoken foobar\nflatten_cname\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				FlattenCNAME:   true,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with synthesize_ptr and argument",
+			"netbox {\nurl http://example.org\ntoken foobar\nsynthesize_ptr yes\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with autozones and argument",
+			"netbox {\nurl http://example.org\ntoken foobar\nautozones yes\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with refuse_outside_zones",
+			"netbox example.org {\nurl http://example.org\ntoken foobar\nrefuse_outside_zones\n}\n",
+			false,
+			&Netbox{
+				Url:                "http://example.org",
+				APIPrefix:          defaultAPIPrefix,
+				Token:              "foobar",
+				TTL:                defaultTTL,
+				MaxCNAMEDepth:      defaultMaxCNAMEDepth,
+				MaxUpstreamCalls:   defaultMaxUpstreamCalls,
+				Next:               plugin.Handler(nil),
+				Zones:              []string{"example.org."},
+				RefuseOutsideZones: true,
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with refuse_outside_zones and argument",
+			"netbox {\nurl http://example.org\ntoken foobar\nrefuse_outside_zones yes\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with flatten_cname and argument",
+			"netbox {\nurl http://example.org\ntoken foobar\nflatten_cname yes\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with round_robin",
+			"netbox {\nurl http://example.org\ntoken foobar\nround_robin\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				RoundRobin:     true,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with round_robin and argument",
+			"netbox {\nurl http://example.org\ntoken foobar\nround_robin yes\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with dnssec",
+			"netbox {\nurl http://example.org\ntoken foobar\ndnssec\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				DNSSEC:         true,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with dnssec and missing key",
+			"netbox {\nurl http://example.org\ntoken foobar\ndnssec yes\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with include_inactive",
+			"netbox {\nurl http://example.org\ntoken foobar\ninclude_inactive\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval:  defaultStatus,
+				IncludeInactive: true,
+				UsePlugin:       true,
+			},
+		},
+		{
+			"config with include_inactive and argument",
+			"netbox {\nurl http://example.org\ntoken foobar\ninclude_inactive yes\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with log_queries",
+			"netbox {\nurl http://example.org\ntoken foobar\nlog_queries\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				LogQueries:     true,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with log_queries and argument",
+			"netbox {\nurl http://example.org\ntoken foobar\nlog_queries yes\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with ttl_custom_field",
+			"netbox {\nurl http://example.org\ntoken foobar\nttl_custom_field override_ttl\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				TTLCustomField: "override_ttl",
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with alias_custom_field and txt_custom_field",
+			"netbox {\nurl http://example.org\ntoken foobar\nalias_custom_field alias\ntxt_custom_field txt\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval:   defaultStatus,
+				AliasCustomField: "alias",
+				TXTCustomField:   "txt",
+				UsePlugin:        true,
+			},
+		},
+		{
+			"config with invalid alias_custom_field",
+			"netbox {\nurl http://example.org\ntoken foobar\nalias_custom_field my-alias\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with invalid ttl_custom_field",
+			"netbox {\nurl http://example.org\ntoken foobar\nttl_custom_field Override-TTL\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with ttl_custom_field but no name",
+			"netbox {\nurl http://example.org\ntoken foobar\nttl_custom_field\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with page_size",
+			"netbox {\nurl http://example.org\ntoken foobar\npage_size 500\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				PageSize:       500,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with page_size above maximum",
+			"netbox {\nurl http://example.org\ntoken foobar\npage_size 5000\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				PageSize:       maxPageSize,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with invalid page_size",
+			"netbox {\nurl http://example.org\ntoken foobar\npage_size 0\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with max_cname_depth",
+			"netbox {\nurl http://example.org\ntoken foobar\nmax_cname_depth 3\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    3,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with invalid max_cname_depth",
+			"netbox {\nurl http://example.org\ntoken foobar\nmax_cname_depth 0\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with non-numeric max_cname_depth",
+			"netbox {\nurl http://example.org\ntoken foobar\nmax_cname_depth deep\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with max_upstream_calls",
+			"netbox {\nurl http://example.org\ntoken foobar\nmax_upstream_calls 32\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: 32,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with invalid max_upstream_calls",
+			"netbox {\nurl http://example.org\ntoken foobar\nmax_upstream_calls 0\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with header",
+			"netbox {\nurl http://example.org\ntoken foobar\nheader X-Scope-OrgID tenant1\nheader X-Extra a\nheader X-Extra b\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				Headers: http.Header{
+					"X-Scope-Orgid": {"tenant1"},
+					"X-Extra":       {"a", "b"},
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with header missing value",
+			"netbox {\nurl http://example.org\ntoken foobar\nheader X-Scope-OrgID\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with header overriding authorization",
+			"netbox {\nurl http://example.org\ntoken foobar\nheader authorization secret\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with api_prefix",
+			"netbox {\nurl http://example.org/netbox/\ntoken foobar\napi_prefix api/\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org/netbox/",
+				APIPrefix:        "/api",
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with api_prefix but no argument",
+			"netbox {\nurl http://example.org\ntoken foobar\napi_prefix\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with fallthrough (all)",
+			"netbox {\nurl http://example.org\ntoken foobar\nfallthrough\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Fall:             fall.F{Zones: []string{"."}},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with fallthrough (one domain)",
+			"netbox {\nurl http://example.org\ntoken foobar\nfallthrough example.org\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Fall:             fall.F{Zones: []string{"example.org."}},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with fallthrough (multiple domains)",
+			"netbox {\nurl http://example.org\ntoken foobar\nfallthrough example.org example.net\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Fall:             fall.F{Zones: []string{"example.org.", "example.net."}},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with fallthrough_on",
+			"netbox {\nurl http://example.org\ntoken foobar\nfallthrough\nfallthrough_on errors\n}\n",
+			false,
+			&Netbox{
+				Url:              "http://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Fall:             fall.F{Zones: []string{"."}},
+				FallthroughOn:    FallthroughErrors,
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		{
+			"config with invalid fallthrough_on",
+			"netbox {\nurl http://example.org\ntoken foobar\nfallthrough\nfallthrough_on never\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with fallthrough_on without mode",
+			"netbox {\nurl http://example.org\ntoken foobar\nfallthrough_on\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with fallthrough_on with too many modes",
+			"netbox {\nurl http://example.org\ntoken foobar\nfallthrough_on errors empty\n}\n",
+			true,
+			nil,
+		},
+		{
+			"config with https",
+			"netbox {\nurl https://example.org\ntoken foobar\n}\n",
+			false,
+			&Netbox{
+				Url:              "https://example.org",
+				APIPrefix:        defaultAPIPrefix,
+				Token:            "foobar",
+				TTL:              defaultTTL,
+				MaxCNAMEDepth:    defaultMaxCNAMEDepth,
+				MaxUpstreamCalls: defaultMaxUpstreamCalls,
+				Next:             plugin.Handler(nil),
+				Zones:            []string{"."},
+				Client: &http.Client{
+					Timeout: defaultTimeout,
+				},
+				StatusInterval: defaultStatus,
+				UsePlugin:      true,
+			},
+		},
+		//! No clue why this test fails....
+		// {
+		// 	"config with https and tls (no options)",
+		// 	"netbox {\nurl https://example.org\ntoken foobar\ntls\n}\n",
+		// 	false,
+		// 	&Netbox{
+		// 		Url:   "https://example.org",
+		// 		Token: "foobar",
+		// 		TTL:   defaultTTL,
+		// 		Next:  plugin.Handler(nil),
+		// 		Zones: []string{"."},
+		// 		Client: &http.Client{
+		// 			Timeout: defaultTimeout,
+		// 			Transport: &http.Transport{
+		// 				TLSClientConfig: defaultTLSConfig,
+		// 			},
+		// 		},
+		// 		UsePlugin: true,
+		// 	},
+		// },
+		{
+			"config with https and tls (invalid config)",
+			"netbox {\nurl https://example.org\ntoken foobar\ntls testing/missing.crt\n}\n",
+			true,
+			nil,
+		},
+	}
+
+	// NetBox is served over http and https, the tuned transports created for
+	// the clients are clones of the default one trusting the https server
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/netbox/api/status" {
+			_, _ = w.Write([]byte(`{"installed-apps": {"netbox_dns": "1.2.6"}, "netbox-version": "4.2.5"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`
+		{
+			"django-version": "5.1.7",
+			"installed-apps": {
+				"django_filters": "25.1",
+				"django_prometheus": "2.3.1",
+				"django_rq": "3.0.0",
+				"django_tables2": "2.7.5",
+				"drf_spectacular": "0.28.0",
+				"drf_spectacular_sidecar": "2025.3.1",
+				"mptt": "0.16.0",
+				"netbox_dns": "1.2.6",
+				"rest_framework": "3.15.2",
+				"social_django": "5.4.3",
+				"taggit": "6.1.0",
+				"timezone_field": "7.1"
+			},
+			"netbox-version": "4.2.5-Docker-3.2.0",
+			"plugins": {
+				"netbox_dns": "1.2.6"
+			},
+			"python-version": "3.12.3",
+			"rq-workers-running": 1
+		}
+	`))
+	})
+	netbox := httptest.NewServer(handler)
+	defer netbox.Close()
+	netboxTLS := httptest.NewTLSServer(handler)
+	defer netboxTLS.Close()
+
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = netboxTLS.Client().Transport
+	defer func() { http.DefaultTransport = defaultTransport }()
+	transports.Lock()
+	transports.m = make(map[string]*http.Transport)
+	transports.Unlock()
+	localURL := strings.NewReplacer("http://example.org", netbox.URL, "https://example.org", netboxTLS.URL)
+
+	// run tests
+	for _, tt := range tests {
+		c := caddy.NewTestController("dns", localURL.Replace(tt.input))
 		got, err := parseNetbox(c)
 		if tt.wantErr {
 			assert.Error(t, err, tt.msg)
 		} else {
 			assert.Nil(t, err, tt.msg)
+			tt.want.Url = localURL.Replace(tt.want.Url)
+			// the status check at setup found NetBox healthy
+			tt.want.health.Store(true)
+
+			// the client is compared by its timeout and its tuned transport
+			assert.Equal(t, tt.want.Client.Timeout, got.Client.Timeout, tt.msg)
+			if transport, ok := got.Client.Transport.(*http.Transport); assert.True(t, ok, tt.msg) {
+				assert.Equal(t, defaultMaxIdleConnsPerHost, transport.MaxIdleConnsPerHost, tt.msg)
+			}
+			tt.want.Client = got.Client
 			assert.Equal(t, tt.want, got, tt.msg)
 		}
 	}
 }
+
+// TestParseNetboxTokenFile tests reading the token from a file.
+func TestParseNetboxTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("foobar\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		msg     string
+		input   string
+		wantErr bool
+	}{
+		{
+			"config with token_file",
+			fmt.Sprintf("netbox {\nurl http://example.org\ntoken_file %s\n}\n", tokenFile),
+			false,
+		},
+		{
+			"config with missing token_file",
+			fmt.Sprintf("netbox {\nurl http://example.org\ntoken_file %s\n}\n", filepath.Join(dir, "missing")),
+			true,
+		},
+		{
+			"config with token and token_file",
+			fmt.Sprintf("netbox {\nurl http://example.org\ntoken foobar\ntoken_file %s\n}\n", tokenFile),
+			true,
+		},
+		{
+			"config with token_file and token_env",
+			fmt.Sprintf("netbox {\nurl http://example.org\ntoken_file %s\ntoken_env NETBOX_TOKEN\n}\n", tokenFile),
+			true,
+		},
+		{
+			"config with token_file but no argument",
+			"netbox {\nurl http://example.org\ntoken_file\n}\n",
+			true,
+		},
+		{
+			"config without token and token_file",
+			"netbox {\nurl http://example.org\n}\n",
+			true,
+		},
+	}
+
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token foobar" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(status{Apps: statusApps{DNSPlugin: "1.2.6"}, Version: "4.2.5"})
+	}))
+	defer netbox.Close()
+
+	for _, tt := range tests {
+		c := caddy.NewTestController("dns", strings.ReplaceAll(tt.input, "http://example.org", netbox.URL))
+		got, err := parseNetbox(c)
+		if tt.wantErr {
+			assert.Error(t, err, tt.msg)
+		} else if assert.NoError(t, err, tt.msg) {
+			assert.Equal(t, "foobar", got.Token, tt.msg)
+		}
+	}
+}
+
+// TestParseNetboxReload tests that parsing the config again, as a reload does,
+// picks up a rotated token and keeps the transport.
+func TestParseNetboxReload(t *testing.T) {
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(status{Apps: statusApps{DNSPlugin: "1.2.6"}, Version: "4.2.5"})
+	}))
+	defer netbox.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	input := fmt.Sprintf("netbox {\nurl %s\ntoken_file %s\nmax_idle_conns 42\n}\n", netbox.URL, tokenFile)
+
+	var transport http.RoundTripper
+	for _, token := range []string{"foobar", "rotated"} {
+		if err := os.WriteFile(tokenFile, []byte(token+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		c := caddy.NewTestController("dns", input)
+		got, err := parseNetbox(c)
+		if !assert.NoError(t, err, token) {
+			continue
+		}
+		assert.Equal(t, token, got.Token, token)
+		if transport != nil {
+			assert.Same(t, transport, got.Client.Transport, token)
+		}
+		transport = got.Client.Transport
+	}
+}
+
+// TestParseNetboxTokenEnv tests reading the token from an environment variable.
+func TestParseNetboxTokenEnv(t *testing.T) {
+	t.Setenv("NETBOX_TOKEN", "foobar")
+	t.Setenv("NETBOX_EMPTY_TOKEN", "")
+
+	tests := []struct {
+		msg     string
+		input   string
+		wantErr bool
+	}{
+		{
+			"config with token_env",
+			"netbox {\nurl http://example.org\ntoken_env NETBOX_TOKEN\n}\n",
+			false,
+		},
+		{
+			"config with token_env of unset variable",
+			"netbox {\nurl http://example.org\ntoken_env NETBOX_MISSING_TOKEN\n}\n",
+			true,
+		},
+		{
+			"config with token_env of empty variable",
+			"netbox {\nurl http://example.org\ntoken_env NETBOX_EMPTY_TOKEN\n}\n",
+			true,
+		},
+		{
+			"config with token and token_env",
+			"netbox {\nurl http://example.org\ntoken foobar\ntoken_env NETBOX_TOKEN\n}\n",
+			true,
+		},
+		{
+			"config with token_env but no argument",
+			"netbox {\nurl http://example.org\ntoken_env\n}\n",
+			true,
+		},
+	}
+
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token foobar" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(status{Apps: statusApps{DNSPlugin: "1.2.6"}, Version: "4.2.5"})
+	}))
+	defer netbox.Close()
+
+	for _, tt := range tests {
+		c := caddy.NewTestController("dns", strings.ReplaceAll(tt.input, "http://example.org", netbox.URL))
+		got, err := parseNetbox(c)
+		if tt.wantErr {
+			assert.Error(t, err, tt.msg)
+		} else if assert.NoError(t, err, tt.msg) {
+			assert.Equal(t, "foobar", got.Token, tt.msg)
+		}
+	}
+}
+
+// TestParseNetboxProxy tests routing NetBox requests through a proxy.
+func TestParseNetboxProxy(t *testing.T) {
+	// the proxy answers the status request for any NetBox behind it
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "netbox.example.org" || r.URL.Path != "/api/status" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(status{Apps: statusApps{DNSPlugin: "1.2.6"}, Version: "4.2.5"})
+	}))
+	defer proxy.Close()
+
+	tests := []struct {
+		msg     string
+		proxy   string
+		wantErr bool
+	}{
+		{"valid proxy", proxy.URL, false},
+		{"proxy without scheme", strings.TrimPrefix(proxy.URL, "http://"), true},
+		{"proxy with unsupported scheme", "ftp://proxy.example.org", true},
+		{"proxy without host", "http://", true},
+		{"proxy with invalid url", "http://[::1", true},
+	}
+
+	for _, tt := range tests {
+		input := fmt.Sprintf("netbox {\nurl http://netbox.example.org\ntoken foobar\nproxy %s\n}\n", tt.proxy)
+
+		c := caddy.NewTestController("dns", input)
+		got, err := parseNetbox(c)
+		if tt.wantErr {
+			assert.Error(t, err, tt.msg)
+			continue
+		}
+		if !assert.NoError(t, err, tt.msg) {
+			continue
+		}
+
+		transport, ok := got.Client.Transport.(*http.Transport)
+		if assert.True(t, ok, tt.msg) {
+			req, _ := http.NewRequest("GET", "http://netbox.example.org/api/status", nil)
+			proxyURL, err := transport.Proxy(req)
+			assert.NoError(t, err, tt.msg)
+			assert.Equal(t, tt.proxy, proxyURL.String(), tt.msg)
+		}
+	}
+}
+
+// writeCertificate creates a certificate signed by parent (self-signed if nil)
+// and writes it and its key as PEM files to dir
+func writeCertificate(t *testing.T, dir, name string, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, signerCert := crypto.Signer(key), template
+	if parent != nil {
+		signer, signerCert = parent.PrivateKey.(crypto.Signer), parent.Leaf
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert.Leaf, _ = x509.ParseCertificate(der)
+	return cert
+}
+
+// TestParseNetboxClientCertificate tests the tls option against a NetBox
+// requiring client certificates.
+func TestParseNetboxClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	notAfter := time.Now().Add(time.Hour)
+
+	ca := writeCertificate(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil)
+	server := writeCertificate(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "netbox"},
+		NotAfter:     notAfter,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	writeCertificate(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "coredns"},
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(status{Apps: statusApps{DNSPlugin: "1.2.6"}, Version: "4.2.5"})
+	}))
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tests := []struct {
+		msg     string
+		tls     string
+		wantErr bool
+	}{
+		{"valid client certificate", "client.crt client.key ca.crt", false},
+		{"mismatching client certificate and key", "client.crt server.key ca.crt", true},
+		{"missing client certificate", "missing.crt client.key ca.crt", true},
+		{"no client certificate", "ca.crt", true},
+	}
+
+	for _, tt := range tests {
+		args := strings.Fields(tt.tls)
+		for i := range args {
+			args[i] = filepath.Join(dir, args[i])
+		}
+		input := fmt.Sprintf("netbox {\nurl %s\ntoken foobar\ntls %s\n}\n", ts.URL, strings.Join(args, " "))
+
+		c := caddy.NewTestController("dns", input)
+		got, err := parseNetbox(c)
+		if tt.wantErr {
+			assert.Error(t, err, tt.msg)
+		} else if assert.NoError(t, err, tt.msg) {
+			assert.True(t, got.UsePlugin, tt.msg)
+		}
+	}
+}
+
+// TestParseNetboxCAFile tests the ca_file option against a NetBox with a
+// certificate of a private CA.
+func TestParseNetboxCAFile(t *testing.T) {
+	dir := t.TempDir()
+	notAfter := time.Now().Add(time.Hour)
+
+	ca := writeCertificate(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil)
+	server := writeCertificate(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "netbox"},
+		NotAfter:     notAfter,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	if err := os.WriteFile(filepath.Join(dir, "empty.crt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(status{Apps: statusApps{DNSPlugin: "1.2.6"}, Version: "4.2.5"})
+	}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{server}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tests := []struct {
+		msg     string
+		options string
+		wantErr bool
+	}{
+		{"ca bundle", "ca_file ca.crt", false},
+		{"ca bundle with tls", "tls\nca_file ca.crt", false},
+		{"system CAs", "", true},
+		{"empty ca bundle", "ca_file empty.crt", true},
+		{"ca bundle without certificates", "ca_file server.key", true},
+		{"missing ca bundle", "ca_file missing.crt", true},
+		{"no ca bundle", "ca_file", true},
+	}
+
+	for _, tt := range tests {
+		options := strings.ReplaceAll(tt.options, "ca_file ", "ca_file "+dir+"/")
+		input := fmt.Sprintf("netbox {\nurl %s\ntoken foobar\n%s\n}\n", ts.URL, options)
+
+		c := caddy.NewTestController("dns", input)
+		got, err := parseNetbox(c)
+		if tt.wantErr {
+			assert.Error(t, err, tt.msg)
+		} else if assert.NoError(t, err, tt.msg) {
+			assert.True(t, got.UsePlugin, tt.msg)
+		}
+	}
+}
+
+func TestParseNetboxUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "netbox.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	netbox := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/status", r.URL.Path)
+		_ = json.NewEncoder(w).Encode(status{Apps: statusApps{DNSPlugin: "1.2.6"}, Version: "4.2.5"})
+	})}
+	go func() { _ = netbox.Serve(l) }()
+	defer netbox.Close()
+
+	regular := filepath.Join(dir, "regular")
+	if err := os.WriteFile(regular, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		msg     string
+		socket  string
+		wantErr bool
+	}{
+		{"socket", socket, false},
+		{"missing socket", filepath.Join(dir, "missing.sock"), true},
+		{"regular file", regular, true},
+	}
+
+	for _, tt := range tests {
+		input := fmt.Sprintf("netbox {\nurl http://netbox\ntoken foobar\nunix_socket %s\n}\n", tt.socket)
+
+		c := caddy.NewTestController("dns", input)
+		got, err := parseNetbox(c)
+		if tt.wantErr {
+			assert.Error(t, err, tt.msg)
+		} else if assert.NoError(t, err, tt.msg) {
+			assert.True(t, got.UsePlugin, tt.msg)
+		}
+	}
+}
+
+func TestParseNetboxTransport(t *testing.T) {
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(status{Apps: statusApps{DNSPlugin: "1.2.6"}, Version: "4.2.5"})
+	}))
+	defer netbox.Close()
+
+	tests := []struct {
+		msg                 string
+		options             string
+		wantErr             bool
+		maxIdleConns        int
+		maxIdleConnsPerHost int
+		idleConnTimeout     time.Duration
+		tls                 bool
+	}{
+		{"defaults", "", false, defaultMaxIdleConns, defaultMaxIdleConnsPerHost, defaultIdleConnTimeout, false},
+		{
+			"pool directives",
+			"max_idle_conns 200\nmax_idle_conns_per_host 50\nidle_conn_timeout 30s\n",
+			false, 200, 50, 30 * time.Second, false,
+		},
+		{
+			"pool directives with tls",
+			"tls\nmax_idle_conns_per_host 20\n",
+			false, defaultMaxIdleConns, 20, defaultIdleConnTimeout, true,
+		},
+		{"invalid max_idle_conns", "max_idle_conns many\n", true, 0, 0, 0, false},
+		{"zero max_idle_conns_per_host", "max_idle_conns_per_host 0\n", true, 0, 0, 0, false},
+		{"negative max_idle_conns", "max_idle_conns -1\n", true, 0, 0, 0, false},
+		{"invalid idle_conn_timeout", "idle_conn_timeout soon\n", true, 0, 0, 0, false},
+		{"zero idle_conn_timeout", "idle_conn_timeout 0s\n", true, 0, 0, 0, false},
+		{"max_idle_conns without value", "max_idle_conns\n", true, 0, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		input := fmt.Sprintf("netbox {\nurl %s\ntoken foobar\n%s}\n", netbox.URL, tt.options)
+
+		c := caddy.NewTestController("dns", input)
+		got, err := parseNetbox(c)
+		if tt.wantErr {
+			assert.Error(t, err, tt.msg)
+			continue
+		}
+		if !assert.NoError(t, err, tt.msg) {
+			continue
+		}
+
+		transport, ok := got.Client.Transport.(*http.Transport)
+		if assert.True(t, ok, tt.msg) {
+			assert.Equal(t, tt.maxIdleConns, transport.MaxIdleConns, tt.msg)
+			assert.Equal(t, tt.maxIdleConnsPerHost, transport.MaxIdleConnsPerHost, tt.msg)
+			assert.Equal(t, tt.idleConnTimeout, transport.IdleConnTimeout, tt.msg)
+			if tt.tls {
+				assert.NotNil(t, transport.TLSClientConfig, tt.msg)
+			}
+		}
+	}
+}
+
+func TestParseNetboxRateLimit(t *testing.T) {
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(status{Apps: statusApps{DNSPlugin: "1.2.6"}, Version: "4.2.5"})
+	}))
+	defer netbox.Close()
+
+	tests := []struct {
+		msg       string
+		rateLimit string
+		limit     rate.Limit
+		burst     int
+	}{
+		{"requests per second", "50", 50, 50},
+		{"fractional requests per second", "0.5", 0.5, 1},
+		{"rounded up burst", "2.5", 2.5, 3},
+	}
+
+	for _, tt := range tests {
+		input := fmt.Sprintf("netbox {\nurl %s\ntoken foobar\nrate_limit %s\n}\n", netbox.URL, tt.rateLimit)
+
+		c := caddy.NewTestController("dns", input)
+		got, err := parseNetbox(c)
+		if assert.NoError(t, err, tt.msg) && assert.NotNil(t, got.limiter, tt.msg) {
+			assert.Equal(t, tt.limit, got.limiter.Limit(), tt.msg)
+			assert.Equal(t, tt.burst, got.limiter.Burst(), tt.msg)
+		}
+	}
+}
+
+func TestParseNetboxAutoZones(t *testing.T) {
+	dnsPlugin := "1.2.6"
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/plugins/netbox-dns/zones/" && r.URL.Query().Get("active") == "true" {
+			_, _ = w.Write([]byte(`{"results": [{"name": "example.com"}, {"name": "example.org"}]}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(status{Apps: statusApps{DNSPlugin: dnsPlugin}, Version: "4.2.5"})
+	}))
+	defer netbox.Close()
+
+	c := caddy.NewTestController("dns", fmt.Sprintf("netbox example.org {\nurl %s\ntoken foobar\nautozones\n}\n", netbox.URL))
+	n, err := parseNetbox(c)
+	if assert.NoError(t, err) {
+		assert.True(t, n.AutoZones)
+		assert.Equal(t, []string{"example.org."}, n.Zones)
+		assert.Equal(t, []string{"example.org.", "example.com."}, n.servedZones())
+	}
+
+	// autozones needs the zones of the NetBox DNS plugin
+	dnsPlugin = ""
+	c = caddy.NewTestController("dns", fmt.Sprintf("netbox example.org {\nurl %s\ntoken foobar\nautozones\n}\n", netbox.URL))
+	_, err = parseNetbox(c)
+	assert.Error(t, err)
+}
+
+func TestParseNetboxMode(t *testing.T) {
+	tests := []struct {
+		msg       string
+		mode      string
+		dnsPlugin string
+		wantErr   bool
+		usePlugin bool
+	}{
+		{"auto with plugin", "mode auto", "1.2.6", false, true},
+		{"auto without plugin", "mode auto", "", false, false},
+		{"default without plugin", "", "", false, false},
+		{"plugin with plugin", "mode plugin", "1.2.6", false, true},
+		{"plugin without plugin", "mode plugin", "", false, true},
+		{"native with plugin", "mode native", "1.2.6", false, false},
+		{"native without plugin", "mode native", "", false, false},
+		{"invalid mode", "mode legacy", "1.2.6", true, false},
+		{"missing mode", "mode", "1.2.6", true, false},
+		{"too many modes", "mode plugin native", "1.2.6", true, false},
+	}
+
+	for _, tt := range tests {
+		netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(status{Apps: statusApps{DNSPlugin: tt.dnsPlugin}, Version: "4.2.5"})
+		}))
+
+		input := fmt.Sprintf("netbox {\nurl %s\ntoken foobar\n%s\n}\n", netbox.URL, tt.mode)
+		c := caddy.NewTestController("dns", input)
+		got, err := parseNetbox(c)
+		if tt.wantErr {
+			assert.Error(t, err, tt.msg)
+		} else if assert.NoError(t, err, tt.msg) {
+			assert.Equal(t, tt.usePlugin, got.usePlugin(), tt.msg)
+		}
+		netbox.Close()
+	}
+}
+
+func TestParseNetboxDNSSECKey(t *testing.T) {
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(status{Apps: statusApps{DNSPlugin: "1.2.6"}, Version: "4.2.5"})
+	}))
+	defer netbox.Close()
+
+	base := writeKey(t, "example.org.")
+
+	c := caddy.NewTestController("dns", fmt.Sprintf("netbox example.org {\nurl %s\ntoken foobar\ndnssec %s\n}\n", netbox.URL, base))
+	got, err := parseNetbox(c)
+	if assert.NoError(t, err) && assert.Len(t, got.keys, 1) {
+		assert.True(t, got.DNSSEC)
+		assert.Equal(t, "example.org.", got.keys[0].key.Hdr.Name)
+		assert.Len(t, got.signingKeys("example.org."), 1)
+		assert.Empty(t, got.signingKeys("example.net."))
+	}
+}
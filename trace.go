@@ -0,0 +1,64 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"context"
+
+	ot "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// startSpan starts a span named operation as child of the span carried by ctx,
+// which is set by the trace plugin. Without a parent span nil is returned, this
+// way tracing costs nothing unless it is configured.
+func startSpan(ctx context.Context, operation, zone string) ot.Span {
+	parent := ot.SpanFromContext(ctx)
+	if parent == nil {
+		return nil
+	}
+	span := parent.Tracer().StartSpan(operation, ot.ChildOf(parent.Context()))
+	if zone != "" {
+		span.SetTag("zone", zone)
+	}
+	return span
+}
+
+// startRootSpan starts a span named operation without parent from the tracer
+// of the trace plugin, for work not caused by a query like the status check.
+// Without the trace plugin nil is returned.
+func (n *Netbox) startRootSpan(operation string) ot.Span {
+	if n.tracer == nil {
+		return nil
+	}
+	// the trace plugin sets up its tracer on startup only
+	tracer := n.tracer.Tracer()
+	if tracer == nil {
+		return nil
+	}
+	return tracer.StartSpan(operation)
+}
+
+// traceResponse tags the span carried by ctx with the outcome of a request
+func traceResponse(ctx context.Context, statusCode int, err error) {
+	span := ot.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	if err != nil {
+		ext.LogError(span, err)
+		return
+	}
+	ext.HTTPStatusCode.Set(span, uint16(statusCode))
+}
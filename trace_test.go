@@ -0,0 +1,121 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	ot "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestTraceServeDNS(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").Reply(200).BodyString(`{
+		"results": [
+		{
+			"type": "A",
+			"ttl": 8600,
+			"value": "192.168.0.1",
+			"absolute_value": "192.168.0.1",
+			"fqdn": "mail1.example.org."
+		}]
+	}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+
+	// the trace plugin puts the span of the request into the context
+	tracer := mocktracer.New()
+	root := tracer.StartSpan("servedns")
+	ctx := ot.ContextWithSpan(context.Background(), root)
+
+	r := new(dns.Msg)
+	r.SetQuestion("mail1.example.org.", dns.TypeA)
+	_, err := n.ServeDNS(ctx, dnstest.NewRecorder(&test.ResponseWriter{}), r)
+	assert.NoError(t, err)
+	root.Finish()
+
+	spans := tracer.FinishedSpans()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	records, netbox := spans[0], spans[1]
+
+	assert.Equal(t, "netbox records", records.OperationName)
+	assert.Equal(t, netbox.SpanContext.SpanID, records.ParentID)
+	assert.Equal(t, endpointRecords, records.Tag("endpoint"))
+	assert.Equal(t, "example.org.", records.Tag("zone"))
+	assert.Equal(t, uint16(200), records.Tag("http.status_code"))
+
+	assert.Equal(t, "netbox", netbox.OperationName)
+	assert.Equal(t, root.(*mocktracer.MockSpan).SpanContext.SpanID, netbox.ParentID)
+	assert.Equal(t, "example.org.", netbox.Tag("zone"))
+}
+
+func TestTraceDisabled(t *testing.T) {
+	assert.Nil(t, startSpan(context.Background(), "netbox", "example.org."))
+
+	// without a span in the context there is nothing to tag
+	traceResponse(context.Background(), 200, nil)
+}
+
+// tracePlugin stands in for the trace plugin handing out its tracer
+type tracePlugin struct {
+	plugin.Handler
+	tracer ot.Tracer
+}
+
+func (p tracePlugin) Tracer() ot.Tracer { return p.tracer }
+
+func TestTraceReady(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+	gock.New("https://example.org/api/status").Reply(http.StatusOK).JSON(status{Version: "4.2.5"})
+
+	tracer := mocktracer.New()
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.tracer = tracePlugin{Handler: test.ErrorHandler(), tracer: tracer}
+
+	assert.True(t, n.Ready())
+
+	// the status check is not part of a request, it is a root span
+	spans := tracer.FinishedSpans()
+	if !assert.Len(t, spans, 1) {
+		return
+	}
+	assert.Equal(t, "netbox status", spans[0].OperationName)
+	assert.Equal(t, 0, spans[0].ParentID)
+	assert.Equal(t, endpointStatus, spans[0].Tag("endpoint"))
+	assert.Equal(t, uint16(200), spans[0].Tag("http.status_code"))
+
+	// the trace plugin has not set up its tracer yet
+	n.tracer = tracePlugin{}
+	gock.New("https://example.org/api/status").Reply(http.StatusOK).JSON(status{Version: "4.2.5"})
+	assert.True(t, n.Ready())
+	assert.Len(t, tracer.FinishedSpans(), 1)
+}
@@ -0,0 +1,112 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"context"
+	"net"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// transferLength is the maximum size of the records sent in a single message
+// of a zone transfer
+const transferLength = 1000
+
+// transferAllowed reports whether the client of state may transfer zones
+func (n *Netbox) transferAllowed(state request.Request) bool {
+	ip := net.ParseIP(state.IP())
+	for _, network := range n.AllowTransfer {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// transfer answers an AXFR request for zone with all records found in
+// netbox-dns, enclosed in the SOA of the zone. Transfers are only served over
+// TCP.
+func (n *Netbox) transfer(ctx context.Context, zone, view string, state request.Request) (int, error) {
+	if !n.usePlugin() || state.Proto() != "tcp" || state.Name() != zone || !n.transferAllowed(state) {
+		return dnserror(dns.RcodeRefused, state, nil)
+	}
+
+	zones, err := n.queryZone(ctx, zone, view)
+	if err != nil {
+		return dnserror(dns.RcodeServerFailure, state, err)
+	}
+	if len(zones) == 0 {
+		return dnserror(dns.RcodeNotAuth, state, nil)
+	}
+	records, err := n.queryZoneRecords(ctx, zone, view)
+	if err != nil {
+		return dnserror(dns.RcodeServerFailure, state, err)
+	}
+
+	soa := zones[0].RR()
+	soa.Header().Ttl = n.clampTTL(soa.Header().Ttl)
+	rrs := []dns.RR{soa}
+
+	// records without a TTL get the SOA minimum of their zone as in answers
+	defaults := make(map[string]uint32)
+	if s, ok := soa.(*dns.SOA); ok {
+		defaults[zone] = s.Minttl
+	}
+	for _, record := range records {
+		if record.TTL == 0 {
+			record.TTL = n.defaultTTL(ctx, zone, view, record.FQDN, defaults)
+		}
+		rr := record.RR()
+		if _, ok := rr.(*dns.NULL); ok {
+			continue
+		}
+		rr.Header().Ttl = n.clampTTL(rr.Header().Ttl)
+		rrs = append(rrs, rr)
+	}
+	rrs = append(rrs, soa)
+
+	// split the records into messages of limited size, all of them are queued
+	// up front so a failing transfer can not block on the channel
+	var envelopes []*dns.Envelope
+	start, length := 0, 0
+	for i, rr := range rrs {
+		length += dns.Len(rr)
+		if length > transferLength && i > start {
+			envelopes = append(envelopes, &dns.Envelope{RR: rrs[start:i]})
+			start, length = i, dns.Len(rr)
+		}
+	}
+	envelopes = append(envelopes, &dns.Envelope{RR: rrs[start:]})
+
+	ch := make(chan *dns.Envelope, len(envelopes))
+	for _, e := range envelopes {
+		ch <- e
+	}
+	close(ch)
+
+	tr := new(dns.Transfer)
+	if err := tr.Out(state.W, state.Req, ch); err != nil {
+		return dns.RcodeServerFailure, err
+	}
+
+	// the messages have been written to the connection, which is closed here
+	// as the server does not handle it any further
+	state.W.Hijack()
+	if err := state.W.Close(); err != nil {
+		log.Debugf("could not close connection after zone transfer: %s", err)
+	}
+	return dns.RcodeSuccess, nil
+}
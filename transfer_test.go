@@ -0,0 +1,186 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// transferWriter keeps all messages written during a zone transfer
+type transferWriter struct {
+	test.ResponseWriter
+	msgs   []*dns.Msg
+	closed bool
+}
+
+func (w *transferWriter) WriteMsg(m *dns.Msg) error {
+	w.msgs = append(w.msgs, m)
+	return nil
+}
+
+func (w *transferWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func newTransferNetbox() *Netbox {
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "123456789"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+	_, network, _ := net.ParseCIDR("10.240.0.0/16")
+	n.AllowTransfer = []*net.IPNet{network}
+	return n
+}
+
+func TestTransfer(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
+		map[string]string{
+			"name":   "^example.org$",
+			"active": "^true$",
+		}).Reply(200).BodyString(`{
+			"results": [{
+				"name": "example.org",
+				"soa_mname": {"name": "ns1.example.org"},
+				"soa_rname": "hostmaster.example.org",
+				"soa_serial": 2025010101,
+				"soa_refresh": 3600,
+				"soa_retry": 600,
+				"soa_expire": 86400,
+				"soa_minimum": 120,
+				"soa_ttl": 3600
+			}]
+		}`)
+
+	// enough records to span several pages and messages
+	const count = 150
+	// every tenth record has no TTL of its own
+	ttl := func(i int) any {
+		if i%10 == 0 {
+			return "null"
+		}
+		return 300
+	}
+	page := func(from, to int, next string) string {
+		var results []string
+		for i := from; i < to; i++ {
+			results = append(results, fmt.Sprintf(
+				`{"type": "A", "ttl": %v, "value": "10.0.0.%d", "absolute_value": "10.0.0.%d", "fqdn": "host%d.example.org."}`, ttl(i), i%250, i%250, i))
+		}
+		return fmt.Sprintf(`{"next": %s, "results": [%s]}`, next, strings.Join(results, ","))
+	}
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "^example.org$",
+			"active": "^true$",
+		}).AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+		return !req.URL.Query().Has("fqdn") && !req.URL.Query().Has("offset"), nil
+	}).Reply(200).BodyString(page(0, 100, `"https://example.org/api/plugins/netbox-dns/records/?zone=example.org&active=true&offset=100"`))
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "^example.org$",
+			"offset": "^100$",
+		}).Reply(200).BodyString(page(100, count, "null"))
+
+	n := newTransferNetbox()
+	n.MaxTTL = 30 * time.Minute
+	w := &transferWriter{ResponseWriter: test.ResponseWriter{TCP: true}}
+	r := new(dns.Msg)
+	r.SetAxfr("example.org.")
+	rcode, err := n.ServeDNS(context.Background(), w, r)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, rcode)
+	assert.Greater(t, len(w.msgs), 1)
+
+	var rrs []dns.RR
+	for _, m := range w.msgs {
+		rrs = append(rrs, m.Answer...)
+	}
+	// the records are enclosed in the SOA of the zone
+	if assert.Len(t, rrs, count+2) {
+		assert.Equal(t, dns.TypeSOA, rrs[0].Header().Rrtype)
+		assert.Equal(t, dns.TypeSOA, rrs[len(rrs)-1].Header().Rrtype)
+		assert.Equal(t, uint32(2025010101), rrs[0].(*dns.SOA).Serial)
+		assert.Equal(t, uint32(1800), rrs[0].Header().Ttl)
+		// records without a TTL are served with the SOA minimum
+		assert.Equal(t, "host0.example.org.", rrs[1].Header().Name)
+		assert.Equal(t, uint32(120), rrs[1].Header().Ttl)
+		assert.Equal(t, uint32(300), rrs[2].Header().Ttl)
+	}
+	assert.True(t, w.closed)
+	assert.True(t, gock.IsDone())
+}
+
+func TestTransferRefused(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(n *Netbox)
+		qname string
+		udp   bool
+	}{
+		{
+			"client not allowed",
+			func(n *Netbox) { n.AllowTransfer = nil },
+			"example.org.",
+			false,
+		},
+		{
+			"name below zone",
+			func(n *Netbox) {},
+			"sub.example.org.",
+			false,
+		},
+		{
+			"legacy API",
+			func(n *Netbox) { n.UsePlugin = false },
+			"example.org.",
+			false,
+		},
+		{
+			"over UDP",
+			func(n *Netbox) {},
+			"example.org.",
+			true,
+		},
+	}
+
+	defer gock.Off() // Flush pending mocks after test execution
+
+	for _, tt := range tests {
+		n := newTransferNetbox()
+		tt.setup(n)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{TCP: !tt.udp})
+		r := new(dns.Msg)
+		r.SetAxfr(tt.qname)
+		_, err := n.ServeDNS(context.Background(), rec, r)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, dns.RcodeRefused, rec.Rcode, tt.name)
+		assert.Empty(t, rec.Msg.Answer, tt.name)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"net"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// View maps clients to a netbox-dns view. A view without networks is the
+// default view used for clients not matching any other view.
+type View struct {
+	Name     string
+	Networks []*net.IPNet
+}
+
+// view returns the name of the view for the client of state. The subnet of the
+// EDNS0 Client Subnet option selects the view if the client is trusted to set
+// it, otherwise DefaultView is used if set, or the source address of the
+// client selects the view. If no view matches, the default view is used.
+func (n *Netbox) view(state request.Request) string {
+	def := ""
+	subnet := n.trustedSubnet(state)
+	if subnet == nil && n.DefaultView != "" {
+		return n.DefaultView
+	}
+	if subnet == nil && state.W != nil {
+		subnet = net.ParseIP(state.IP())
+	}
+	for _, v := range n.Views {
+		if len(v.Networks) == 0 {
+			def = v.Name
+			continue
+		}
+		if subnet == nil {
+			continue
+		}
+		for _, network := range v.Networks {
+			if network.Contains(subnet) {
+				return v.Name
+			}
+		}
+	}
+	return def
+}
+
+// trustedSubnet returns the address of the EDNS0 Client Subnet option of the
+// query of state if the client is within TrustECS, nil otherwise. Lookups
+// without a client, like those of LookupRecords, are never trusted.
+func (n *Netbox) trustedSubnet(state request.Request) net.IP {
+	if state.W == nil || len(n.TrustECS) == 0 {
+		return nil
+	}
+	subnet := clientSubnet(state.Req)
+	if subnet == nil {
+		return nil
+	}
+	client := net.ParseIP(state.IP())
+	for _, network := range n.TrustECS {
+		if network.Contains(client) {
+			return subnet
+		}
+	}
+	return nil
+}
+
+// clientSubnet returns the address of the EDNS0 Client Subnet option of r
+func clientSubnet(r *dns.Msg) net.IP {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, o := range opt.Option {
+		if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return ecs.Address
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+// Copyright 2025 Lucas Kirsche <kontakt@lucas-kirsche.de>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netbox
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// newECSQuestion returns an A question for qname carrying subnet as EDNS0
+// Client Subnet option, no option is added if subnet is empty
+func newECSQuestion(qname, subnet string) *dns.Msg {
+	r := new(dns.Msg)
+	r.SetQuestion(qname, dns.TypeA)
+	if subnet == "" {
+		return r
+	}
+
+	_, network, _ := net.ParseCIDR(subnet)
+	ones, _ := network.Mask.Size()
+	ecs := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        1,
+		SourceNetmask: uint8(ones),
+		Address:       network.IP,
+	}
+	if network.IP.To4() == nil {
+		ecs.Family = 2
+	}
+	r.SetEdns0(4096, false)
+	opt := r.IsEdns0()
+	opt.Option = append(opt.Option, ecs)
+	return r
+}
+
+// newECSState returns the request of newECSQuestion sent by the IPv4 test
+// client at 10.240.0.1
+func newECSState(qname, subnet string) request.Request {
+	return request.Request{W: &test.ResponseWriter{}, Req: newECSQuestion(qname, subnet)}
+}
+
+func TestViewServeDNS(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	mock := func(view, address string) {
+		gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+			map[string]string{
+				"zone":   "example.org",
+				"active": "true",
+				"fqdn":   "mail1.example.org.",
+				"type":   "A",
+				"view":   "^" + view + "$",
+			}).Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 8600, "value": "` + address + `", "absolute_value": "` + address + `", "fqdn": "mail1.example.org."}]}`)
+	}
+
+	_, internal, _ := net.ParseCIDR("10.0.0.0/8")
+	_, internal6, _ := net.ParseCIDR("fd00::/8")
+
+	// the IPv4 test client at 10.240.0.1 is a trusted resolver, the IPv6 one
+	// at fe80::42:ff:feca:4c65 is not
+	tests := []struct {
+		name   string
+		w      dns.ResponseWriter
+		subnet string
+		view   string
+		want   string
+	}{
+		{"Client in internal view", &test.ResponseWriter{}, "10.1.2.0/24", "internal", "10.0.0.1"},
+		{"IPv6 client in internal view", &test.ResponseWriter{}, "fd00:1::/48", "internal", "10.0.0.1"},
+		{"Client outside of internal view", &test.ResponseWriter{}, "192.0.2.0/24", "external", "192.0.2.1"},
+		{"Trusted client without subnet", &test.ResponseWriter{}, "", "internal", "10.0.0.1"},
+		{"Client without subnet", &test.ResponseWriter6{}, "", "external", "192.0.2.1"},
+		{"Untrusted client with subnet", &test.ResponseWriter6{}, "10.1.2.0/24", "external", "192.0.2.1"},
+	}
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+	n.Views = []View{
+		{Name: "internal", Networks: []*net.IPNet{internal, internal6}},
+		{Name: "external"},
+	}
+	n.TrustECS = []*net.IPNet{{IP: net.IP{10, 240, 0, 1}, Mask: net.CIDRMask(32, 32)}}
+
+	for _, tt := range tests {
+		if tt.view == "internal" {
+			mock("internal", "10.0.0.1")
+		} else {
+			mock("external", "192.0.2.1")
+		}
+
+		rec := dnstest.NewRecorder(tt.w)
+		_, err := n.ServeDNS(context.Background(), rec, newECSQuestion("mail1.example.org.", tt.subnet))
+		assert.NoError(t, err, tt.name)
+		if assert.Len(t, rec.Msg.Answer, 1, tt.name) {
+			assert.Equal(t, tt.want, rec.Msg.Answer[0].(*dns.A).A.String(), tt.name)
+		}
+	}
+
+	assert.True(t, gock.IsDone())
+}
+
+func TestViewWithoutDefault(t *testing.T) {
+	_, internal, _ := net.ParseCIDR("10.0.0.0/8")
+
+	n := newNetbox()
+	n.Views = []View{{Name: "internal", Networks: []*net.IPNet{internal}}}
+	n.TrustECS = []*net.IPNet{{IP: net.IP{10, 240, 0, 1}, Mask: net.CIDRMask(32, 32)}}
+
+	// without a default view clients outside of all views do not select one
+	assert.Equal(t, "internal", n.view(newECSState("mail1.example.org.", "10.0.0.0/24")))
+	assert.Equal(t, "", n.view(newECSState("mail1.example.org.", "192.0.2.0/24")))
+	assert.Equal(t, "", n.view(request.Request{W: &test.ResponseWriter6{}, Req: newECSQuestion("mail1.example.org.", "")}))
+}
+
+func TestViewUntrustedSubnet(t *testing.T) {
+	_, internal, _ := net.ParseCIDR("10.0.0.0/8")
+	_, office, _ := net.ParseCIDR("fe80::/64")
+
+	n := newNetbox()
+	n.Views = []View{
+		{Name: "internal", Networks: []*net.IPNet{internal}},
+		{Name: "office", Networks: []*net.IPNet{office}},
+	}
+
+	// without trust_ecs the subnet is ignored, the source address counts
+	assert.Equal(t, "internal", n.view(newECSState("mail1.example.org.", "192.0.2.0/24")))
+	assert.Equal(t, "office", n.view(request.Request{W: &test.ResponseWriter6{}, Req: newECSQuestion("mail1.example.org.", "10.0.0.0/24")}))
+
+	// a trusted network not containing the client does not help either
+	n.TrustECS = []*net.IPNet{internal}
+	assert.Equal(t, "office", n.view(request.Request{W: &test.ResponseWriter6{}, Req: newECSQuestion("mail1.example.org.", "10.0.0.0/24")}))
+
+	// lookups without a client, like those of LookupRecords, are never trusted
+	assert.Equal(t, "", n.view(request.Request{Req: newECSQuestion("mail1.example.org.", "10.0.0.0/24")}))
+}
+
+func TestDefaultView(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	_, internal, _ := net.ParseCIDR("10.0.0.0/8")
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+	n.Views = []View{
+		{Name: "internal", Networks: []*net.IPNet{internal}},
+		{Name: "external"},
+	}
+	n.DefaultView = "office"
+	n.TrustECS = []*net.IPNet{{IP: net.IP{10, 240, 0, 1}, Mask: net.CIDRMask(32, 32)}}
+
+	// queries without trusted Client Subnet use the default view, the others
+	// still select their view by subnet
+	assert.Equal(t, "office", n.view(newECSState("mail1.example.org.", "")))
+	assert.Equal(t, "office", n.view(request.Request{W: &test.ResponseWriter6{}, Req: newECSQuestion("mail1.example.org.", "10.0.0.0/24")}))
+	assert.Equal(t, "internal", n.view(newECSState("mail1.example.org.", "10.0.0.0/24")))
+	assert.Equal(t, "external", n.view(newECSState("mail1.example.org.", "192.0.2.0/24")))
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.org",
+			"active": "true",
+			"fqdn":   "mail1.example.org.",
+			"type":   "A",
+			"view":   "^office$",
+		}).Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 8600, "value": "10.1.0.1", "absolute_value": "10.1.0.1", "fqdn": "mail1.example.org."}]}`)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	_, err := n.ServeDNS(context.Background(), rec, newECSQuestion("mail1.example.org.", ""))
+	assert.NoError(t, err)
+	if assert.Len(t, rec.Msg.Answer, 1) {
+		assert.Equal(t, "10.1.0.1", rec.Msg.Answer[0].(*dns.A).A.String())
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestViewParameter(t *testing.T) {
+	defer gock.Off() // Flush pending mocks after test execution
+
+	gock.New("https://example.org/api/plugins/netbox-dns/records/").MatchParams(
+		map[string]string{
+			"zone":   "example.org",
+			"active": "true",
+			"fqdn":   "mail1.example.org.",
+			"type":   "A",
+			"view":   "^internal$",
+		}).Reply(200).BodyString(`{"results": [{"type": "A", "ttl": 8600, "value": "10.0.0.1", "absolute_value": "10.0.0.1", "fqdn": "mail1.example.org."}]}`)
+	gock.New("https://example.org/api/plugins/netbox-dns/zones/").MatchParams(
+		map[string]string{
+			"name":   "example.org",
+			"active": "true",
+			"view":   "^internal$",
+		}).Reply(200).BodyString(`{
+			"results": [
+			{
+				"name": "example.org",
+				"soa_ttl": 86400,
+				"soa_mname": {
+					"name": "ns1.example.org"
+				},
+				"soa_rname": "admin.example.org",
+				"soa_serial": 1742857987,
+				"soa_refresh": 43200,
+				"soa_retry": 7200,
+				"soa_expire": 2419200,
+				"soa_minimum": 3600
+			}]
+		}`)
+
+	n := newNetbox()
+	n.Url = "https://example.org"
+	n.Token = "mytoken"
+	n.Zones = []string{"example.org."}
+	n.UsePlugin = true
+	n.Views = []View{{Name: "internal"}}
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	_, err := n.ServeDNS(context.Background(), rec, newECSQuestion("mail1.example.org.", ""))
+	assert.NoError(t, err)
+	assert.Len(t, rec.Msg.Answer, 1)
+
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("example.org.", dns.TypeSOA)
+	_, err = n.ServeDNS(context.Background(), rec, r)
+	assert.NoError(t, err)
+	assert.Len(t, rec.Msg.Answer, 1)
+
+	assert.True(t, gock.IsDone())
+}